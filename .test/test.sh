@@ -25,6 +25,95 @@ try-file() {
   fi
 }
 
+try-files() {
+  expected="$1"
+  shift
+  lang "$@" > tmp.s
+  gcc -no-pie -o tmp tmp.s
+  actual=`./tmp`
+  if [ "$actual" != "$expected" ]; then
+    echo "$@ => Expected $expected but got $actual"
+    exit 1
+  fi
+}
+
+try-run() {
+  expected="$1"
+  shift
+  actual=`lang run "$@"`
+  if [ "$actual" != "$expected" ]; then
+    echo "$@ => Expected $expected but got $actual"
+    exit 1
+  fi
+}
+
+try-emit() {
+  input="$1"
+  emit="$2"
+  expected="$3"
+  actual=`echo "$input" | lang --emit="$emit"`
+  if [ "$actual" != "$expected" ]; then
+    echo "$input => Expected \"$expected\" but got \"$actual\""
+    exit 1
+  fi
+}
+
+try-reproducible() {
+  file="$1"
+  expected=`lang "$file"`
+  for i in 1 2 3 4 5; do
+    actual=`lang "$file"`
+    if [ "$actual" != "$expected" ]; then
+      echo "$file => Expected the same assembly code in every compilation"
+      exit 1
+    fi
+  done
+}
+
+try-error() {
+  input="$1"
+  expected="$2"
+  actual=`echo "$input" | lang "${@:3}" 2>&1 > /dev/null`
+  status="$?"
+  actual=`echo "$actual" | grep -v '^ '` # omit source snippets
+  if [ "$status" == 0 ] || [ "$actual" != "$expected" ]; then
+    echo "$input => Expected error \"$expected\" but got \"$actual\""
+    exit 1
+  fi
+}
+
+try-warning() {
+  input="$1"
+  expected="$2"
+  actual=`echo "$input" | lang "${@:3}" 2>&1 > /dev/null`
+  status="$?"
+  actual=`echo "$actual" | grep -v '^ '` # omit source snippets
+  if [ "$status" != 0 ] || [ "$actual" != "$expected" ]; then
+    echo "$input => Expected warning \"$expected\" but got \"$actual\""
+    exit 1
+  fi
+}
+
+try-render() {
+  input="$1"
+  expected="$2"
+  actual=`echo "$input" | lang 2>&1 > /dev/null`
+  if [ "$actual" != "$expected" ]; then
+    echo "$input => Expected error \"$expected\" but got \"$actual\""
+    exit 1
+  fi
+}
+
+try-json() {
+  input="$1"
+  expected="$2"
+  actual=`echo "$input" | lang --diagnostics=json 2>&1 > /dev/null`
+  if [ "$actual" != "$expected" ]; then
+    echo "$input => Expected error \"$expected\" but got \"$actual\""
+    exit 1
+  fi
+}
+
 try "0;" 0
 try "42;" 42
 try "10; 100;" 100
@@ -132,9 +221,135 @@ try-file .test/func2.lg true
 try-file .test/func3.lg 15
 try-file .test/func4.lg 91
 try-file .test/func5.lg "-55, 385, 110"
+try-file .test/func6.lg $'328.0 26.75 x7\n1 2 3 4 5 6 7 eight 1.0 2.0 3.0 4.0 5.0 6.0 7.0 8.0 9.0'
 try-file .test/func-fib.lg 102334155
 
 try-file .test/array1.lg ok
 try-file .test/array2.lg ok
 
+try-file .test/struct1.lg "1 2 20 4 10 4"
+try-file .test/struct2.lg $'0 4 7 56\n3 12 6 69 12 148'
+try-file .test/tuple1.lg "3 1 1 5 0 2 1 3 2 1 9 2 yes"
+try-file .test/enum1.lg "12 12 0 0 3 6 27 pair 5 6 leaf"
+try-file .test/match1.lg "many zero few few few four many six many many ? neg low low mid mid ? huge 1 1 2 0 3"
+try-file .test/generic1.lg "12 18 8 3 b 4 seven 7 20 id 3 2"
+try-file .test/generic2.lg $'describe\ndescribe\ndescribe\ndescribe\ndescribe\nint!nonebool!float!char!'
+try-file .test/type1.lg $'answer\n5 42 84 7 seven 2 -5 45\n2 2'
+try-file .test/float1.lg $'6.00 -22.50 7 1.750 12.56636\n1.75 7 9.5 3 1 1\n1 0 1 0 1 0\n2.25 0.333333 -7\n1 2.5 3 0 1 0 0'
+try-file .test/int1.lg $'4 -128 4294967295 1 9223372036854775807 65543 -5 -2147483648 255 0 1 4\nneg3 7 -3 3 -56\n18446744073709551616 9223372036854775808 9223372036854777856 12345\n10000000000000000000 9223372036854775808 9200000000000000000 9223372036854775808'
+try-file .test/bit1.lg $'165 240 493 1000000 160 245 85 -166 1024 -4 0 -1\n8 1 2 255 -1 980 64 15 17 1\naf63dc4c8601ec8c ffffffffffffffff -1 1'
+try-file .test/string1.lg $'hello, bob! 11 0 1 0 1 1 0 1 1\n[lang] [uage] [] 1 0 1\n1 0 <a><b><c>\n[la] [] [language] []'
+try-file .test/interp1.lg $'total: 3 items\npen x2, ink x1\ntrue 1.5 é😀 255 -1 0..3\n[[1, 2], [3, 4]] [a, b] [true] nested 4 ${n}\n[] 2'
+try-file .test/slice1.lg $'0 0 10 16 1 0\n[0, 1, 4, 100, 17, 25, 36, 49, 64, 81]\n[1, 2, 3, 4, 5] [1, 2, 3, 4, 5, 6] [9, 2, 3] 3\n5 ink\n5 1 0 [a, b, cd, aa, bb]\n[[1, 2, 3, 4, 5], [42]]\n41 287 cap'
+try-file .test/string2.lg $'line1\n  "quoted" \\n ${x}\nend\nAB 😀 é café \a\v|\n20 0 0 65 128512\nsame 1\n\\x41${"\\x41"}\\"$'
+try-file .test/char1.lg $'0:104 1:233 2:108 3:108 4:111 5:44 6:32 7:19990 8:30028 9:32 10:128512 11:33 \n4 QQ 65 128512 0 1\n32\n97 65533 65533 65533 65533 33 233 \n9 7 6 4 128 55295 57344 1114111 \n65533 65533 65533 65533 55295 57344 1114111 65533 65533 \xef\xbf\xbd'
+try-file .test/option1.lg $'2 none bob nobody 1 30 3 0 5 4 1 7 x\n4\n42\n8'
+
+try-files 42 .test/files1.lg .test/files2.lg
+
+try-reproducible .test/func5.lg
+try-reproducible .test/generic1.lg
+try-reproducible .test/generic2.lg
+try-reproducible .test/option1.lg
+try-reproducible .test/array2.lg
+try-run 42 .test/files1.lg .test/files2.lg -- foo
+try-run 15 .test/func3.lg
+
+lang build .test/func3.lg -o tmp
+[ "`./tmp`" == 15 ] || { echo "lang build => Expected 15"; exit 1; }
+echo "7;" | lang run
+[ "$?" == 7 ] || { echo "lang run => Expected exit status 7"; exit 1; }
+lang check .test/func3.lg || { echo "lang check => Expected success"; exit 1; }
+
+try-emit "x = -1;" tokens $'1,1-1,2\tidentifier\t"x"\n1,3-1,4\t=\t"="\n1,5-1,7\tnumber\t"-1"\n1,7-1,8\t;\t";"\n2,1-2,1\teof\t""'
+try-emit "x = 1 - 1;" ast 'Program
+  Stmts[0]: AssignStmt 1,1-1,11 Op="="
+    Target: Ident 1,1-1,2 Name="x"
+    Value: InfixExpr 1,5-1,10 Op="-"
+      Left: IntLit 1,5-1,6 Value=1
+      Right: IntLit 1,9-1,10 Value=1'
+try-emit "var x = 1; x - 1;" typed-ast 'Program
+  Stmts[0]: VarStmt 1,1-1,11
+    Vars[0]: VarDecl 1,5-1,10 Name="x" VarType=int
+      Value: IntLit 1,9-1,10 Value=1 : int
+  Stmts[1]: ExprStmt 1,12-1,18
+    Expr: InfixExpr 1,12-1,17 Op="-" : int
+      Left: Ident 1,12-1,13 Name="x" -> VarDecl x 1,5 : int
+      Right: IntLit 1,16-1,17 Value=1 : int'
+
+try-error "1@;" "1,2: error: invalid character @"
+try-error "var x = ;" "1,9: error: unexpected ;"
+try-error "x;" "1,1: error: x is not declared"
+try-error "1 + true;" "1,5: error: expected int operand, but got bool"
+try-error "func f() -> int { return; }" "1,19: error: expected int return, but got nothing"
+
+try-error "var a = ; var b: int = true; c;" $'1,9: error: unexpected ;\n1,24: error: expected int value for b, but got bool\n1,30: error: c is not declared'
+try-error "{ foo(1; } 2 + true;" $'1,8: error: expected , or ), but got ;\n1,16: error: expected int operand, but got bool'
+try-error "retrun 1; func f() { 1 }" $'1,1: error: unexpected identifier retrun\n1,1: note: did you mean return?\n1,24: error: expected ;, but got }'
+try-error "func f() -> int { retrun 1; } f(); fucn g() { iff true {} }" $'1,19: error: unexpected identifier retrun\n1,19: note: did you mean return?\n1,36: error: unexpected identifier fucn\n1,36: note: did you mean func?'
+try-error "var count = 1; { var total = 2; coutn + totl; }" $'1,33: error: coutn is not declared\n1,5: note: did you mean count?\n1,41: error: totl is not declared\n1,22: note: did you mean total?'
+try-error "var ab = 1; var ac = 2; ad;" $'1,25: error: ad is not declared\n1,5: note: did you mean ab?\n1,17: note: did you mean ac?'
+try-error "var x = y; x + 1; x[0];" "1,9: error: y is not declared"
+try-error "var n = 1; var x: Lst = 1; func f(a: [2]n) {}" $'1,19: error: Lst is not declared\n1,41: error: n is not a type'
+try-error "struct P { x: int, y: int } var p = P{x: true, z: 1};" $'1,37: error: missing field y in P literal\n1,42: error: expected int value for x, but got bool\n1,48: error: P has no field z'
+try-error "struct P { x: int } var p = P{x: 1}; p.y; p == p; P;" $'1,38: error: P has no field y\n1,43: error: P values cannot be compared\n1,51: error: P is a type, not a value'
+try-error "struct A { b: B } struct B { n: int } var b: A = B{n: 1};" "1,50: error: expected A value for b, but got B"
+try-error "func f() -> (int, int) { return 1; } var a, b, c = f();" $'1,33: error: expected (int, int) return, but got int\n1,52: error: expected 3 values, but got (int, int)'
+try-error "var t = (1, 2); t == t; a, b += 1;" $'1,17: error: (int, int) values cannot be compared\n1,30: error: expected =, but got +='
+try-error "struct A { b: B } struct B { a: A }" $'1,8: error: invalid recursive type A\n1,26: error: invalid recursive type B'
+try-error "struct E {} struct F { e: int }" "1,8: error: struct E must have at least one field"
+try-error "enum E { A(int), B } var e = E.B; E.C; E.A; E.A(true); e == e;" $'1,35: error: E has no variant C\n1,40: error: missing payload of E.A\n1,49: error: expected int parameter, but got bool\n1,56: error: E values cannot be compared'
+try-error "enum E { A(int), B } var e = E.B; match e { A(x, y) => {} }" $'1,41: error: missing B in match\n1,45: error: wrong number of bindings (expected 1, got 2)'
+try-error "enum E { A(int), B } var e = E.B; match e { A(x) => {} A(y) => {} _ => {} B => {} } match 1 { C => {} }" $'1,56: error: A is already matched\n1,75: error: unreachable arm after _\n1,95: error: expected int pattern, but got variant C'
+try-error "match 1 { \"a\" => {} 0..2, 1, 1 => {} } match \"s\" { \"a\", -1 => {} } match true { _ => {} }" $'1,11: error: expected int pattern, but got string\n1,30: error: 1 is already matched\n1,57: error: expected string pattern, but got int\n1,74: error: expected int, string or enum, but got bool'
+try-error "var x = 1; match x { 2 * 3 => {} }" "1,22: error: invalid pattern"
+try-error "var x = 1; match i8(x) { 200, -128..128 => {} _ => {} } match u8(x) { 0..257 => {} -1, 255 => {} _ => {} }" $'1,26: error: 200 is out of range for i8\n1,74: error: 257 is out of range for u8\n1,84: error: -1 is out of range for u8'
+try-error "enum E { A(E), B(int), B }" $'1,6: error: invalid recursive type E\n1,24: error: B has already been declared\n1,16: note: previously declared here'
+try-error "func id[T](x: T) -> T { return x; } var a = id; var b = id(1, 2);" $'1,45: error: cannot use generic function id without calling it\n1,57: error: wrong number of parameters (expected 1, got 2)'
+try-error "func f[]() {} f();" "1,7: error: empty type parameter list"
+try-error "func same[T](a: T, b: T) -> bool { return a == b; } func z[T]() -> int { return 0; } same(1, \"x\"); z();" $'1,94: error: expected int parameter, but got string\n1,100: error: cannot infer T of z'
+try-error "func h[T](x: T) -> int { return x + 1; } h(1); h('c'); h(true);" $'1,33: error: expected int operand, but got char\n1,48: note: in h[char] instantiated here\n1,33: error: expected int operand, but got bool\n1,56: note: in h[bool] instantiated here'
+try-error "func f[T, T](x: [U]T) { struct S { x: T } }" $'1,11: error: T has already been declared\n1,8: note: previously declared here\n1,14: error: U is not declared\n1,36: error: type parameters cannot be used in struct'
+try-error "type Matrix = [2][2]int; var m: Matrix = [1, 2];" "1,42: error: expected Matrix value for m, but got [2]int"
+try-error "type UserID int; var id = UserID(1); var n: int = id; id + 1; var s = UserID(\"x\"); UserID;" $'1,51: error: expected int value for n, but got UserID\n1,60: error: expected UserID operand, but got int\n1,78: error: cannot convert string to UserID\n1,84: error: UserID is a type, not a value'
+try-error "func f(n: int) {} var a: ?int = 3; f(a); a + 1; var b: int = none;" $'1,38: error: expected int parameter, but got ?int\n1,42: error: expected int operand, but got ?int\n1,62: error: expected int value for b, but got none'
+try-error "var a = none; if var b = 5 {} none == none;" $'1,5: error: cannot infer type of a from none\n1,26: error: expected option, but got int\n1,31: error: none values cannot be compared'
+try-error "var a = 1.5 + 1; var b = 1.5 % 2.0; var c = float(\"x\"); var d = 1e;" $'1,15: error: expected float operand, but got int\n1,26: error: expected int operand, but got float\n1,32: error: expected int operand, but got float\n1,51: error: cannot convert string to float\n1,65: error: cannot parse 1e as float'
+try-error "var a: u8 = 5; var b = u8(1) + 1; var c = i32(true); var d = u16(1) < i8(1);" $'1,13: error: expected u8 value for a, but got int\n1,32: error: expected u8 operand, but got int\n1,47: error: cannot convert bool to i32\n1,71: error: expected u16 operand, but got i8'
+try-error "var a = char(-1); var b = char(0xD800); var c = char(0x110000); var d = char(0x10FFFF);" $'1,14: error: -1 is not a valid code point\n1,32: error: 55296 is not a valid code point\n1,54: error: 1114112 is not a valid code point'
+try-error "var a = 'ab'; var b = 'a' < 1; var c = char(1.5); for x in true {}" $'1,9: error: character literal must contain one character\n1,29: error: expected char operand, but got int\n1,45: error: cannot convert float to char\n1,60: error: expected range, array, slice or string, but got bool'
+try-error "var a = 1.5 & 1; var b = 1 << true; var c = 0b102; var d = 1__0; var e = ~'a'; var f = 0x1_0000_0000_0000_0000;" $'1,9: error: expected int operand, but got float\n1,31: error: expected integer shift count, but got bool\n1,45: error: cannot parse 0b102 as integer\n1,60: error: cannot parse 1__0 as integer\n1,75: error: expected int operand, but got char\n1,88: error: cannot parse 0x1_0000_0000_0000_0000 as integer'
+try-error "var s = \"ab\"; s[0..1] = \"x\"; var n = len(1); var k = s[1]; var q = 1 in s;" $'1,15: error: cannot assign to substring\n1,42: error: expected string, array or slice parameter, but got int\n1,56: error: expected range index, but got int\n1,68: error: expected string operand, but got int'
+try-error "struct P { x: int } var p = P{x: 1}; var s = \"\${p} \${puts(\"a\")}\"; var t = \"\${1 2}\";" $'1,49: error: P values cannot be interpolated\n1,54: error: unexpected void value\n1,80: error: expected }, but got number'
+try-error "var a = \"\\xZ1\"; var c = \"\\u{D800}\"; var d = '\\u12'; var e = \"\\q\";" $'1,9: error: \\x must be followed by two hexadecimal digits\n1,25: error: invalid code point D800\n1,45: error: \\u must be followed by hexadecimal digits in braces\n1,61: error: unknown escape sequence \\q'
+try-error "var a = \"a\\0b\"; var b = \"\\x00\"; var c = \"\${a}\\u{0}\"; var d = '\\0';" $'1,9: error: strings cannot contain the null character\n1,25: error: strings cannot contain the null character\n1,45: error: strings cannot contain the null character'
+try-error "var a = [1]; var s = []int(a); append(a, 2); append(s, 'c'); var c = cap(a); var t = []int([\"x\"]); var b = s == s;" $'1,39: error: expected slice parameter, but got [1]int\n1,56: error: expected int element, but got char\n1,74: error: expected slice parameter, but got [1]int\n1,92: error: cannot convert [1]string to []int\n1,108: error: []int values cannot be compared'
+try-error "var s = []int([1, 2, 3]); var a = [3]int(s); var b = [2][]int(s);" "1,42: error: cannot convert []int to [3]int"
+try-error "type A = [2]B; type B = (A) -> int; type C C; struct S { a: E } type E [2]S;" $'1,21: error: invalid recursive type B\n1,42: error: invalid recursive type C\n1,54: error: invalid recursive type S'
+try-error "type A = []A; type B = [](B) -> int; type C []?C; type D = []E; type E D;" $'1,6: error: invalid recursive type A\n1,20: error: invalid recursive type B'
+
+try-warning "var x = 1;" "1,5: warning: x is declared but not used"
+try-warning "func f() {} var _x = 1;" "1,6: warning: f is declared but not called"
+try-warning "func f(n: int) -> int { return f(n); } f(1);" ""
+try-warning "var f = (n: int) -> int { return f(n); };" "1,5: warning: f is declared but not used"
+try-warning "for x, i in [1, 2] { i; } for _, j in [3] { j; }" "1,5: warning: x is declared but not used"
+try-warning "var x = 1; { var x = 2; x; } x;" ""
+try-warning "var x = 1; { var x = 2; x; } x;" $'1,18: warning: x shadows the outer declaration\n1,5: note: shadowed declaration is here' -W shadow
+try-warning "while true { break; 1; }" $'1,21: warning: unreachable code\n1,14: note: any code following this statement is unreachable'
+try-warning "var x = 1;" "" -W no-unused-var
+try-error "var x = 1;" "1,5: error: x is declared but not used" -W error=unused-var
+try-error "while true { break; 1; }" $'1,21: error: unreachable code\n1,14: note: any code following this statement is unreachable' -W error
+
+try-render "var x = 1; var x = 2;" "1,16: error: x has already been declared
+ 1 | var x = 1; var x = 2;
+   |                ^^^^^
+1,5: note: previously declared here
+ 1 | var x = 1; var x = 2;
+   |     ^^^^^"
+
+try-json "1@;" '{"severity":"error","code":"E0102","file":"","start":{"line":1,"col":2,"offset":1},"end":{"line":1,"col":3,"offset":2},"message":"invalid character @","related":[]}'
+try-json "1€;" '{"severity":"error","code":"E0102","file":"","start":{"line":1,"col":2,"offset":1},"end":{"line":1,"col":3,"offset":4},"message":"invalid character €","related":[]}'
+try-json "var x = 1; var x = y;" '{"severity":"error","code":"E0301","file":"","start":{"line":1,"col":16,"offset":15},"end":{"line":1,"col":21,"offset":20},"message":"x has already been declared","related":[{"file":"","start":{"line":1,"col":5,"offset":4},"end":{"line":1,"col":10,"offset":9},"message":"previously declared here"}]}
+{"severity":"error","code":"E0304","file":"","start":{"line":1,"col":20,"offset":19},"end":{"line":1,"col":21,"offset":20},"message":"y is not declared","related":[]}'
+
 echo OK
@@ -0,0 +1,105 @@
+package ast
+
+import (
+	"reflect"
+
+	"github.com/oshima/lang/types"
+)
+
+var typesType = reflect.TypeOf([]types.Type(nil))
+
+// Clone returns a deep copy of the node, where the types written in the source code
+// are replaced by subst. The references to the nodes inside the copied tree are
+// redirected to their copies, and the others are kept as they are.
+// The instances of generic functions are not copied.
+func Clone(node Node, subst func(types.Type) types.Type) Node {
+	c := &cloner{clones: make(map[Node]Node), subst: subst}
+	clone := c.clone(node)
+	c.relink(clone)
+	return clone
+}
+
+type cloner struct {
+	clones map[Node]Node // original -> copy
+	subst  func(types.Type) types.Type
+}
+
+func (c *cloner) clone(node Node) Node {
+	v := reflect.ValueOf(node).Elem()
+	nv := reflect.New(v.Type())
+	nv.Elem().Set(v) // shallow copy including the embedded fields
+	clone := nv.Interface().(Node)
+	c.clones[node] = clone
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		fv := nv.Elem().Field(i)
+		if f.Anonymous || f.PkgPath != "" || f.Name == "Ref" {
+			continue // embedded, unexported or reference
+		}
+		if f.Name == "Instances" {
+			fv.Set(reflect.Zero(fv.Type()))
+			continue
+		}
+
+		switch {
+		case fv.Type().Implements(nodeType) || fv.Type() == nodeType:
+			if !fv.IsNil() {
+				fv.Set(reflect.ValueOf(c.clone(fv.Interface().(Node))))
+			}
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Implements(nodeType):
+			if fv.IsNil() {
+				continue
+			}
+			s := reflect.MakeSlice(fv.Type(), fv.Len(), fv.Len())
+			for j := 0; j < fv.Len(); j++ {
+				s.Index(j).Set(reflect.ValueOf(c.clone(fv.Index(j).Interface().(Node))))
+			}
+			fv.Set(s)
+		case fv.Type() == typeType:
+			if !fv.IsNil() {
+				fv.Set(reflect.ValueOf(c.subst(fv.Interface().(types.Type))))
+			}
+		case fv.Type() == typesType:
+			if fv.IsNil() {
+				continue
+			}
+			s := make([]types.Type, fv.Len())
+			for j := range s {
+				s[j] = c.subst(fv.Index(j).Interface().(types.Type))
+			}
+			fv.Set(reflect.ValueOf(s))
+		}
+	}
+	return clone
+}
+
+// relink redirects the references in the copied tree.
+func (c *cloner) relink(node Node) {
+	v := reflect.ValueOf(node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		fv := v.Field(i)
+		if f.Anonymous || f.PkgPath != "" {
+			continue
+		}
+
+		switch {
+		case f.Name == "Ref":
+			if fv.IsNil() {
+				continue
+			}
+			if clone, ok := c.clones[fv.Interface().(Node)]; ok {
+				fv.Set(reflect.ValueOf(clone))
+			}
+		case fv.Type().Implements(nodeType) || fv.Type() == nodeType:
+			if !fv.IsNil() {
+				c.relink(fv.Interface().(Node))
+			}
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Implements(nodeType):
+			for j := 0; j < fv.Len(); j++ {
+				c.relink(fv.Index(j).Interface().(Node))
+			}
+		}
+	}
+}
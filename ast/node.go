@@ -11,15 +11,20 @@ import (
 // Node is the interface for all AST nodes.
 type Node interface {
 	Pos() *token.Pos
+	End() *token.Pos
 	SetPos(*token.Pos)
+	SetEnd(*token.Pos)
 }
 
 type node struct {
 	pos *token.Pos
+	end *token.Pos
 }
 
 func (n *node) Pos() *token.Pos       { return n.pos }
+func (n *node) End() *token.Pos       { return n.end }
 func (n *node) SetPos(pos *token.Pos) { n.pos = pos }
+func (n *node) SetEnd(end *token.Pos) { n.end = end }
 
 // Stmt is the interface for all statement nodes.
 type Stmt interface {
@@ -80,7 +85,8 @@ type BlockStmt struct {
 
 // VarStmt represents a statement containing a couple of variable declarations.
 type VarStmt struct {
-	Vars []*VarDecl
+	Vars  []*VarDecl
+	Value Expr // tuple destructured into Vars, or nil
 	stmt
 }
 
@@ -90,8 +96,28 @@ type FuncStmt struct {
 	stmt
 }
 
+// StructStmt represents a statement containing a struct declaration.
+type StructStmt struct {
+	Struct *StructDecl
+	stmt
+}
+
+// EnumStmt represents a statement containing an enum declaration.
+type EnumStmt struct {
+	Enum *EnumDecl
+	stmt
+}
+
+// TypeStmt represents a statement containing a type declaration.
+type TypeStmt struct {
+	Type *TypeDecl
+	stmt
+}
+
 // IfStmt represents an if statement.
+// Instead of the condition, it may have the variable bound to the content of option.
 type IfStmt struct {
+	Var  *VarDecl // if var x = maybe
 	Cond Expr
 	Body *BlockStmt
 	Else Stmt // *BlockStmt or *IfStmt
@@ -114,6 +140,20 @@ type ForStmt struct {
 	stmt
 }
 
+// MatchStmt represents a match statement.
+type MatchStmt struct {
+	Value Expr
+	Arms  []*MatchArm
+	stmt
+}
+
+// MatchArm represents an arm of match statement.
+type MatchArm struct {
+	Patterns []Expr // nil for _
+	Body     *BlockStmt
+	node
+}
+
 // ContinueStmt represents a continue statement.
 type ContinueStmt struct {
 	Ref Node // WhileStmt or ForStmt
@@ -147,6 +187,11 @@ type ExprStmt struct {
 	stmt
 }
 
+// BadStmt represents a statement containing syntax errors.
+type BadStmt struct {
+	stmt
+}
+
 // ----------------------------------------------------------------
 // Expression nodes
 
@@ -172,10 +217,18 @@ type IndexExpr struct {
 	expr
 }
 
+// FieldExpr represents an expression to access a struct field.
+type FieldExpr struct {
+	Left Expr
+	Name string
+	expr
+}
+
 // CallExpr represents an expression to call a function.
 type CallExpr struct {
 	Left   Expr
 	Params []Expr
+	Ref    Node // instance of generic function
 	expr
 }
 
@@ -193,18 +246,50 @@ type Ident struct {
 	expr
 }
 
+// StructLit represents a literal of struct type.
+type StructLit struct {
+	Name   string
+	Fields []*VarDecl // field names and their values
+	Ref    Node       // StructDecl
+	expr
+}
+
 // IntLit represents a literal of integer type.
 type IntLit struct {
 	Value int
 	expr
 }
 
+// FloatLit represents a literal of floating-point type.
+type FloatLit struct {
+	Value float64
+	expr
+}
+
 // BoolLit represents a literal of boolean type.
 type BoolLit struct {
 	Value bool
 	expr
 }
 
+// NoneLit represents the literal of option type without value.
+type NoneLit struct {
+	expr
+}
+
+// SomeExpr represents an expression to make the option with the value.
+// It is inserted by the typechecker where the value is given for option.
+type SomeExpr struct {
+	Value Expr
+	expr
+}
+
+// CharLit represents a literal of character type.
+type CharLit struct {
+	Value rune
+	expr
+}
+
 // StringLit represents a literal of string type.
 type StringLit struct {
 	Value string
@@ -232,6 +317,21 @@ type ArrayShortLit struct {
 	expr
 }
 
+// SliceLit represents a literal of slice type.
+// The elements are copied from the array or slice if given, and empty otherwise.
+type SliceLit struct {
+	ElemType types.Type
+	Value    Expr // array or slice, or nil
+	expr
+}
+
+// TupleLit represents a literal of tuple type.
+// It also represents the targets of destructuring assignment.
+type TupleLit struct {
+	Elems []Expr
+	expr
+}
+
 // FuncLit represents a literal of function type.
 type FuncLit struct {
 	Params     []*VarDecl
@@ -240,6 +340,19 @@ type FuncLit struct {
 	expr
 }
 
+// VariantPattern represents a pattern matching a variant of enum,
+// which binds the payload to the variables.
+type VariantPattern struct {
+	Name     string
+	Bindings []*VarDecl
+	expr
+}
+
+// BadExpr represents an expression containing syntax errors.
+type BadExpr struct {
+	expr
+}
+
 // ----------------------------------------------------------------
 // Declaration nodes
 
@@ -254,8 +367,48 @@ type VarDecl struct {
 // FuncDecl represents a function declaration.
 type FuncDecl struct {
 	Name       string
+	TypeParams []*TypeParamDecl
 	Params     []*VarDecl
 	ReturnType types.Type
 	Body       *BlockStmt
+	Instances  []*FuncDecl // instances of generic function
+	decl
+}
+
+// TypeParamDecl represents a type parameter of generic function.
+type TypeParamDecl struct {
+	Name string
+	Type *types.TypeParam
+	decl
+}
+
+// StructDecl represents a struct declaration.
+type StructDecl struct {
+	Name   string
+	Fields []*VarDecl // field names and their types
+	Type   *types.Struct
+	decl
+}
+
+// EnumDecl represents an enum declaration.
+type EnumDecl struct {
+	Name     string
+	Variants []*VariantDecl
+	Type     *types.Enum
+	decl
+}
+
+// TypeDecl represents a declaration of type alias or defined type.
+// The basic types are also declared in advance, so that they can be used for conversions.
+type TypeDecl struct {
+	Name string
+	Type types.Type // *types.Alias or *types.Defined, or the basic type
+	decl
+}
+
+// VariantDecl represents a variant of enum.
+type VariantDecl struct {
+	Name    string
+	Payload []types.Type
 	decl
 }
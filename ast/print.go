@@ -0,0 +1,119 @@
+package ast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/oshima/lang/token"
+	"github.com/oshima/lang/types"
+)
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	typeType  = reflect.TypeOf((*types.Type)(nil)).Elem()
+	tokenType = reflect.TypeOf(token.Type(0))
+)
+
+// Fprint writes the tree of the node to w, one node per line.
+// If typed is true, the types of the expressions and the targets of the references are also written.
+func Fprint(w io.Writer, node Node, typed bool) error {
+	p := &printer{w: bufio.NewWriter(w), typed: typed}
+	p.print("", node, 0)
+	return p.w.Flush()
+}
+
+type printer struct {
+	w     *bufio.Writer
+	typed bool
+}
+
+func (p *printer) print(label string, node Node, depth int) {
+	v := reflect.ValueOf(node).Elem()
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat("  ", depth))
+	if label != "" {
+		b.WriteString(label + ": ")
+	}
+	b.WriteString(v.Type().Name())
+	if span := p.span(node); span != "" {
+		b.WriteString(" " + span)
+	}
+
+	type child struct {
+		label string
+		node  Node
+	}
+	var children []child
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		fv := v.Field(i)
+		if f.Anonymous || f.PkgPath != "" {
+			continue // embedded or unexported
+		}
+
+		switch {
+		case f.Name == "Ref":
+			if p.typed && !fv.IsNil() {
+				b.WriteString(" -> " + p.describe(fv.Interface().(Node)))
+			}
+		case fv.Type().Implements(nodeType) || fv.Type() == nodeType:
+			if !fv.IsNil() {
+				children = append(children, child{f.Name, fv.Interface().(Node)})
+			}
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Implements(nodeType):
+			for j := 0; j < fv.Len(); j++ {
+				label := fmt.Sprintf("%s[%d]", f.Name, j)
+				children = append(children, child{label, fv.Index(j).Interface().(Node)})
+			}
+		case fv.Type() == typeType:
+			if !fv.IsNil() {
+				fmt.Fprintf(&b, " %s=%s", f.Name, fv.Interface())
+			}
+		case fv.Type() == tokenType:
+			fmt.Fprintf(&b, " %s=%q", f.Name, fv.Interface())
+		case fv.Kind() == reflect.String:
+			fmt.Fprintf(&b, " %s=%q", f.Name, fv.String())
+		default:
+			fmt.Fprintf(&b, " %s=%v", f.Name, fv.Interface())
+		}
+	}
+
+	if e, ok := node.(Expr); ok && p.typed && e.Type() != nil {
+		b.WriteString(" : " + e.Type().String())
+	}
+
+	fmt.Fprintln(p.w, b.String())
+	for _, c := range children {
+		p.print(c.label, c.node, depth+1)
+	}
+}
+
+// span returns the range of the node in the source code.
+func (p *printer) span(node Node) string {
+	pos, end := node.Pos(), node.End()
+	if pos == nil {
+		return ""
+	}
+	if end == nil {
+		return fmt.Sprintf("%d,%d", pos.Line, pos.Col)
+	}
+	return fmt.Sprintf("%d,%d-%d,%d", pos.Line, pos.Col, end.Line, end.Col)
+}
+
+// describe returns the summary of the node referred by another node.
+func (p *printer) describe(node Node) string {
+	v := reflect.ValueOf(node).Elem()
+	s := v.Type().Name()
+	if name := v.FieldByName("Name"); name.IsValid() && name.Kind() == reflect.String {
+		s += " " + name.String()
+	}
+	if pos := node.Pos(); pos != nil {
+		s += fmt.Sprintf(" %d,%d", pos.Line, pos.Col)
+	}
+	return s
+}
@@ -1,5 +1,69 @@
 package ast
 
+import (
+	"github.com/oshima/lang/token"
+	"github.com/oshima/lang/types"
+)
+
+// EnumVariant returns the enum type and the index of the variant
+// if the expression refers to a variant like Shape.Circle, or nil and -1 if not.
+func EnumVariant(expr Expr) (*types.Enum, int) {
+	v, ok := expr.(*FieldExpr)
+	if !ok {
+		return nil, -1
+	}
+	ident, ok := v.Left.(*Ident)
+	if !ok {
+		return nil, -1
+	}
+	decl, ok := ident.Ref.(*EnumDecl)
+	if !ok {
+		return nil, -1
+	}
+	return decl.Type, decl.Type.Variant(v.Name)
+}
+
+// ConvType returns the type which the call expression like UserID(n) converts the parameter to,
+// or nil if the call expression is not a conversion.
+func ConvType(expr *CallExpr) types.Type {
+	ident, ok := expr.Left.(*Ident)
+	if !ok {
+		return nil
+	}
+	decl, ok := ident.Ref.(*TypeDecl)
+	if !ok {
+		return nil
+	}
+	return decl.Type
+}
+
+// NoneOperand returns the other operand if the expression compares an option with none.
+func NoneOperand(expr *InfixExpr) (Expr, bool) {
+	if expr.Op != token.EQ && expr.Op != token.NE {
+		return nil, false
+	}
+	if _, ok := expr.Right.(*NoneLit); ok {
+		return expr.Left, true
+	}
+	if _, ok := expr.Left.(*NoneLit); ok {
+		return expr.Right, true
+	}
+	return nil, false
+}
+
+// IntValue returns the value of the integer literal, which may be negated.
+func IntValue(expr Expr) (int, bool) {
+	switch v := expr.(type) {
+	case *IntLit:
+		return v.Value, true
+	case *PrefixExpr:
+		if n, ok := v.Right.(*IntLit); ok && v.Op == token.MINUS {
+			return -n.Value, true
+		}
+	}
+	return 0, false
+}
+
 // Returnable checks if the input statement can return a value in function.
 func Returnable(stmt Stmt) bool {
 	switch v := stmt.(type) {
@@ -15,8 +79,25 @@ func Returnable(stmt Stmt) bool {
 			return false
 		}
 		return Returnable(v.Body) && Returnable(v.Else)
+	case *MatchStmt:
+		// a match without _ is exhaustive only if it matches the variants of enum
+		exhaustive := false
+		for _, arm := range v.Arms {
+			if !Returnable(arm.Body) {
+				return false
+			}
+			if arm.Patterns == nil {
+				exhaustive = true
+			} else if _, ok := arm.Patterns[0].(*VariantPattern); ok {
+				exhaustive = true
+			}
+		}
+		return exhaustive
 	case *ReturnStmt:
 		return true
+	case *BadStmt:
+		// it may have been meant to return
+		return true
 	default:
 		return false
 	}
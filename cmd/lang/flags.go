@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oshima/lang/diag"
+)
+
+// warningFlags holds the severities of the warnings specified by the -W flags.
+type warningFlags struct {
+	levels map[diag.Code]diag.Severity
+	error  bool // promote all the warnings to errors
+}
+
+func (f *warningFlags) String() string {
+	return ""
+}
+
+func (f *warningFlags) Set(s string) error {
+	switch {
+	case s == "all":
+		for _, code := range diag.Warnings {
+			if _, ok := f.levels[code]; !ok {
+				f.levels[code] = diag.SeverityWarning
+			}
+		}
+	case s == "error":
+		f.error = true
+	case strings.HasPrefix(s, "error="):
+		code, err := lookupWarning(strings.TrimPrefix(s, "error="))
+		if err != nil {
+			return err
+		}
+		f.levels[code] = diag.SeverityError
+	case strings.HasPrefix(s, "no-"):
+		code, err := lookupWarning(strings.TrimPrefix(s, "no-"))
+		if err != nil {
+			return err
+		}
+		delete(f.levels, code)
+	default:
+		code, err := lookupWarning(s)
+		if err != nil {
+			return err
+		}
+		f.levels[code] = diag.SeverityWarning
+	}
+	return nil
+}
+
+func (f *warningFlags) result() map[diag.Code]diag.Severity {
+	if f.error {
+		for code := range f.levels {
+			f.levels[code] = diag.SeverityError
+		}
+	}
+	return f.levels
+}
+
+func lookupWarning(name string) (diag.Code, error) {
+	code, ok := diag.Warnings[name]
+	if !ok {
+		return "", fmt.Errorf("unknown warning: %s", name)
+	}
+	return code, nil
+}
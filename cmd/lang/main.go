@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oshima/lang"
+	"github.com/oshima/lang/diag"
+	"github.com/oshima/lang/token"
+)
+
+const usage = `usage: lang <command> [flags] [files] [-- args]
+
+The files are read from stdin if none is given.
+
+commands:
+  build   compile the files into an executable
+  run     compile and run the files with the arguments after --
+  check   check the files for errors without generating code
+  asm     compile the files into assembly code (default), or print
+          the intermediate results specified by -emit
+
+flags:
+`
+
+// command runs a subcommand with the arguments and returns the exit status.
+type command func(c *config) int
+
+var commands = map[string]command{
+	"build": build,
+	"run":   run,
+	"check": check,
+	"asm":   asm,
+}
+
+var emits = map[string]lang.Emit{
+	"asm":       lang.EmitAsm,
+	"tokens":    lang.EmitTokens,
+	"ast":       lang.EmitAST,
+	"typed-ast": lang.EmitTypedAST,
+}
+
+func main() {
+	args := os.Args[1:]
+	name := "asm"
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			name = args[0]
+			args = args[1:]
+		} else if args[0] == "help" {
+			c := newConfig("help")
+			c.flags.SetOutput(os.Stdout)
+			c.flags.Usage()
+			return
+		}
+	}
+
+	c := newConfig(name)
+	if err := c.parse(args); err != nil {
+		os.Exit(2)
+	}
+	os.Exit(commands[name](c))
+}
+
+// ----------------------------------------------------------------
+// Commands
+
+func build(c *config) int {
+	asm, ok := c.compile(lang.Options{})
+	if !ok {
+		return 1
+	}
+
+	out := c.output
+	if out == "" {
+		out = defaultOutput(c.files)
+	}
+	if err := assembleAndLink(asm, out); err != nil {
+		fmt.Fprintf(os.Stderr, "lang: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func run(c *config) int {
+	asm, ok := c.compile(lang.Options{})
+	if !ok {
+		return 1
+	}
+
+	dir, err := ioutil.TempDir("", "lang")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lang: %s\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, defaultOutput(c.files))
+	if err := assembleAndLink(asm, out); err != nil {
+		fmt.Fprintf(os.Stderr, "lang: %s\n", err)
+		return 1
+	}
+
+	status, err := execute(out, c.args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lang: %s\n", err)
+		return 1
+	}
+	return status
+}
+
+func check(c *config) int {
+	if _, ok := c.compile(lang.Options{Check: true}); !ok {
+		return 1
+	}
+	return 0
+}
+
+func asm(c *config) int {
+	asm, ok := c.compile(lang.Options{Emit: emits[c.emit]})
+	if !ok {
+		return 1
+	}
+
+	if c.output == "" {
+		os.Stdout.Write(asm)
+		return 0
+	}
+	if err := ioutil.WriteFile(c.output, asm, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "lang: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// defaultOutput returns the name of the executable built from the files.
+func defaultOutput(files []string) string {
+	if len(files) == 0 {
+		return "a.out"
+	}
+	base := filepath.Base(files[0])
+	if ext := filepath.Ext(base); ext != "" && ext != base {
+		base = strings.TrimSuffix(base, ext)
+	}
+	return base
+}
+
+// ----------------------------------------------------------------
+// Config
+
+// config holds the flags and arguments given to a command.
+type config struct {
+	flags       *flag.FlagSet
+	output      string
+	emit        string
+	diagnostics string
+	warnings    *warningFlags
+	files       []string // source files
+	args        []string // arguments after --
+}
+
+func newConfig(name string) *config {
+	c := &config{
+		flags:    flag.NewFlagSet("lang "+name, flag.ContinueOnError),
+		warnings: &warningFlags{levels: diag.DefaultWarnings()},
+	}
+	c.flags.Usage = func() {
+		fmt.Fprint(c.flags.Output(), usage)
+		c.flags.PrintDefaults()
+	}
+	c.flags.StringVar(&c.output, "o", "", "write the output to the file")
+	c.flags.StringVar(&c.emit, "emit", "asm", "what the asm command prints (asm, tokens, ast or typed-ast)")
+	c.flags.StringVar(&c.diagnostics, "diagnostics", "text", "format of the diagnostics (text or json)")
+	c.flags.Var(c.warnings, "W", "enable (name or all), disable (no-name) or promote (error=name or error) warnings")
+	return c
+}
+
+// parse parses the arguments, where flags may follow the files.
+func (c *config) parse(args []string) error {
+	for i, arg := range args {
+		if arg == "--" {
+			c.args = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			return err
+		}
+		args = c.flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		c.files = append(c.files, args[0])
+		args = args[1:]
+	}
+
+	if _, ok := emits[c.emit]; !ok {
+		err := fmt.Errorf("unknown emit: %s", c.emit)
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	if c.diagnostics != "text" && c.diagnostics != "json" {
+		err := fmt.Errorf("unknown diagnostics format: %s", c.diagnostics)
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	return nil
+}
+
+// compile compiles the files into assembly code, reporting the diagnostics.
+func (c *config) compile(opts lang.Options) ([]byte, bool) {
+	fset := token.NewFileSet()
+	if len(c.files) > 0 {
+		for _, name := range c.files {
+			src, err := ioutil.ReadFile(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "lang: %s\n", err)
+				return nil, false
+			}
+			fset.AddFile(name, src)
+		}
+	} else {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "lang: %s\n", err)
+			return nil, false
+		}
+		fset.AddFile("", src)
+	}
+
+	var buf bytes.Buffer
+	opts.Warnings = c.warnings.result()
+	res, err := lang.CompileFiles(fset, &buf, opts)
+	if errs, ok := err.(diag.ErrorList); ok {
+		c.report(errs)
+		return nil, false
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lang: %s\n", err)
+		return nil, false
+	}
+	c.report(res.Warnings)
+	return buf.Bytes(), true
+}
+
+func (c *config) report(errs diag.ErrorList) {
+	if c.diagnostics == "json" {
+		diag.WriteJSON(os.Stderr, errs)
+	} else {
+		r := diag.NewRenderer(isTerminal(os.Stderr))
+		r.Render(os.Stderr, errs)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+// cc returns the command used to assemble and link the assembly code.
+func cc() string {
+	if cc := os.Getenv("CC"); cc != "" {
+		return cc
+	}
+	return "gcc"
+}
+
+// assembleAndLink builds the executable out from the assembly code.
+func assembleAndLink(asm []byte, out string) error {
+	path, err := exec.LookPath(cc())
+	if err != nil {
+		return fmt.Errorf("assembler and linker not found: %s (install it or set CC)", cc())
+	}
+
+	dir, err := ioutil.TempDir("", "lang")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "out.s")
+	if err := ioutil.WriteFile(src, asm, 0644); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(path, "-no-pie", "-o", out, src)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Stderr.Write(output)
+		return fmt.Errorf("%s failed: %s", cc(), err)
+	}
+	return nil
+}
+
+// execute runs the executable with the arguments and returns its exit status.
+func execute(path string, args []string) (int, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return 0, nil
+	}
+	exit, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, err
+	}
+	if ws, ok := exit.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		// as the shells do
+		return 128 + int(ws.Signal()), nil
+	}
+	return exit.ExitCode(), nil
+}
@@ -0,0 +1,97 @@
+package diag
+
+// Code identifies the kind of error.
+// Codes are stable so that tools can rely on them.
+type Code string
+
+// The list of error codes.
+const (
+	// scan
+	UnexpectedChar     Code = "E0101"
+	InvalidChar        Code = "E0102"
+	UnterminatedString Code = "E0103"
+
+	// parse
+	Syntax           Code = "E0201"
+	InvalidTarget    Code = "E0202"
+	InvalidInteger   Code = "E0203"
+	UnknownEscape    Code = "E0204"
+	InvalidArrayLen  Code = "E0205"
+	MissingParamType Code = "E0206"
+	ParamInitValue   Code = "E0207"
+	MissingInitValue Code = "E0208"
+	InvalidPattern   Code = "E0209"
+	InvalidFloat     Code = "E0210"
+	InvalidCharLit   Code = "E0211"
+	NullChar         Code = "E0212"
+	EmptyStruct      Code = "E0213"
+
+	// resolve
+	Redeclared    Code = "E0301"
+	IllegalBranch Code = "E0302"
+	NotVariable   Code = "E0303"
+	Undeclared    Code = "E0304"
+	NestedFunc    Code = "E0305"
+	MissingReturn Code = "E0306"
+	NotType       Code = "E0307"
+	NotValue      Code = "E0308"
+
+	// typecheck
+	TypeMismatch     Code = "E0401"
+	VoidValue        Code = "E0402"
+	ArgCount         Code = "E0403"
+	MixedElems       Code = "E0404"
+	UnknownField     Code = "E0405"
+	MissingField     Code = "E0406"
+	DuplicateField   Code = "E0407"
+	RecursiveType    Code = "E0408"
+	NotComparable    Code = "E0409"
+	ValueCount       Code = "E0410"
+	UnknownVariant   Code = "E0411"
+	NonExhaustive    Code = "E0412"
+	DuplicatePattern Code = "E0413"
+	CannotInfer      Code = "E0414"
+	OutOfRange       Code = "E0415"
+
+	// lint
+	UnusedVar   Code = "W0501"
+	UnusedFunc  Code = "W0502"
+	Shadow      Code = "W0503"
+	Unreachable Code = "W0504"
+)
+
+// Warnings maps the names of warnings to their codes.
+var Warnings = map[string]Code{
+	"unused-var":  UnusedVar,
+	"unused-func": UnusedFunc,
+	"shadow":      Shadow,
+	"unreachable": Unreachable,
+}
+
+// DefaultWarnings returns the severities of the warnings enabled by default.
+func DefaultWarnings() map[Code]Severity {
+	return map[Code]Severity{
+		UnusedVar:   SeverityWarning,
+		UnusedFunc:  SeverityWarning,
+		Unreachable: SeverityWarning,
+	}
+}
+
+// Severity represents how serious a diagnostic is.
+type Severity uint8
+
+// The list of severities.
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "unknown"
+}
@@ -0,0 +1,78 @@
+package diag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/oshima/lang/token"
+)
+
+// Error represents an error found in the source code.
+type Error struct {
+	Severity Severity
+	Code     Code
+	Pos      *token.Pos
+	End      *token.Pos // optional
+	Msg      string
+	Notes    []*Note
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// AddNote attaches a note to the error.
+func (e *Error) AddNote(pos *token.Pos, end *token.Pos, msg string) {
+	e.Notes = append(e.Notes, &Note{Pos: pos, End: end, Msg: msg})
+}
+
+// Note represents a supplementary information for an error.
+type Note struct {
+	Pos *token.Pos
+	End *token.Pos // optional
+	Msg string
+}
+
+// ErrorList represents a list of errors.
+type ErrorList []*Error
+
+// Add appends an error to the list.
+func (l *ErrorList) Add(code Code, pos *token.Pos, end *token.Pos, msg string) *Error {
+	e := &Error{Severity: SeverityError, Code: code, Pos: pos, End: end, Msg: msg}
+	*l = append(*l, e)
+	return e
+}
+
+// Sort sorts the list by the positions of errors.
+func (l ErrorList) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Pos.Before(l[j].Pos)
+	})
+}
+
+// HasErrors checks if the list contains any diagnostic of error severity.
+func (l ErrorList) HasErrors() bool {
+	for _, e := range l {
+		if e.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the list as an error, or nil if the list is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+func (l ErrorList) Error() string {
+	var msgs []string
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,73 @@
+package diag
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/oshima/lang/token"
+)
+
+type jsonError struct {
+	Severity string         `json:"severity"`
+	Code     Code           `json:"code"`
+	File     string         `json:"file"`
+	Start    *jsonPos       `json:"start"`
+	End      *jsonPos       `json:"end,omitempty"`
+	Message  string         `json:"message"`
+	Related  []*jsonRelated `json:"related"`
+}
+
+type jsonRelated struct {
+	File    string   `json:"file"`
+	Start   *jsonPos `json:"start"`
+	End     *jsonPos `json:"end,omitempty"`
+	Message string   `json:"message"`
+}
+
+type jsonPos struct {
+	Line   int `json:"line"`
+	Col    int `json:"col"`
+	Offset int `json:"offset"`
+}
+
+// WriteJSON writes the errors in the list to w as JSON objects, one per line.
+func WriteJSON(w io.Writer, errs ErrorList) error {
+	enc := json.NewEncoder(w)
+	for _, e := range errs {
+		obj := &jsonError{
+			Severity: e.Severity.String(),
+			Code:     e.Code,
+			File:     fileName(e.Pos),
+			Start:    newJSONPos(e.Pos),
+			End:      newJSONPos(e.End),
+			Message:  e.Msg,
+			Related:  []*jsonRelated{},
+		}
+		for _, n := range e.Notes {
+			obj.Related = append(obj.Related, &jsonRelated{
+				File:    fileName(n.Pos),
+				Start:   newJSONPos(n.Pos),
+				End:     newJSONPos(n.End),
+				Message: n.Msg,
+			})
+		}
+		if err := enc.Encode(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fileName(pos *token.Pos) string {
+	if pos.File == nil {
+		return ""
+	}
+	return pos.File.Name
+}
+
+func newJSONPos(pos *token.Pos) *jsonPos {
+	if pos == nil {
+		return nil
+	}
+	return &jsonPos{Line: pos.Line, Col: pos.Col, Offset: pos.Offset}
+}
@@ -0,0 +1,95 @@
+package diag
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/oshima/lang/token"
+)
+
+// ANSI escape sequences
+const (
+	bold    = "\x1b[1m"
+	red     = "\x1b[1;31m"
+	magenta = "\x1b[1;35m"
+	cyan    = "\x1b[1;36m"
+	reset   = "\x1b[0m"
+)
+
+// Renderer writes errors together with the snippets of the source code.
+type Renderer struct {
+	color bool // whether to use ANSI escape sequences
+}
+
+// NewRenderer returns a renderer.
+func NewRenderer(color bool) *Renderer {
+	return &Renderer{color: color}
+}
+
+// Render writes the errors and warnings in the list to w.
+func (r *Renderer) Render(w io.Writer, errs ErrorList) {
+	for _, e := range errs {
+		if e.Severity == SeverityWarning {
+			r.render(w, "warning", magenta, e.Pos, e.End, e.Msg)
+		} else {
+			r.render(w, "error", red, e.Pos, e.End, e.Msg)
+		}
+		for _, n := range e.Notes {
+			r.render(w, "note", cyan, n.Pos, n.End, n.Msg)
+		}
+	}
+}
+
+func (r *Renderer) render(w io.Writer, label string, color string, pos *token.Pos, end *token.Pos, msg string) {
+	fmt.Fprintf(w, "%s %s %s\n",
+		r.paint(bold, pos.String()+":"),
+		r.paint(color, label+":"),
+		r.paint(bold, msg),
+	)
+
+	var line []rune
+	if pos.File != nil {
+		line = []rune(pos.File.Line(pos.Line))
+	}
+	begin := pos.Col - 1
+	if begin > len(line) {
+		begin = len(line)
+	}
+
+	// keep tabs in the margin so that carets are aligned with the line
+	var margin strings.Builder
+	for _, ch := range line[:begin] {
+		if ch == '\t' {
+			margin.WriteRune('\t')
+		} else {
+			margin.WriteRune(' ')
+		}
+	}
+
+	width := 1
+	switch {
+	case end == nil:
+		// only the first character
+	case end.Line == pos.Line:
+		width = end.Col - pos.Col
+	case end.Line > pos.Line:
+		// until the end of the first line
+		width = len(line) - begin
+	}
+	if width < 1 {
+		width = 1
+	}
+
+	lineno := fmt.Sprint(pos.Line)
+	gutter := strings.Repeat(" ", len(lineno))
+	fmt.Fprintf(w, " %s | %s\n", lineno, string(line))
+	fmt.Fprintf(w, " %s | %s%s\n", gutter, margin.String(), r.paint(color, strings.Repeat("^", width)))
+}
+
+func (r *Renderer) paint(color string, s string) string {
+	if !r.color {
+		return s
+	}
+	return color + s + reset
+}
@@ -0,0 +1,65 @@
+package diag
+
+import "sort"
+
+// Suggest returns the candidates closest to name by edit distance, in sorted order.
+// Candidates too different from name are not suggested.
+func Suggest(name string, candidates []string) []string {
+	// allow one edit per three characters (no edit for one character)
+	max := (len([]rune(name)) + 1) / 3
+
+	var best []string
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+		d := distance(name, c)
+		if d > max {
+			continue
+		}
+		if d < max {
+			max = d
+			best = nil
+		}
+		best = append(best, c)
+	}
+	sort.Strings(best)
+	return best
+}
+
+// distance returns the optimal string alignment distance between a and b,
+// which counts the transposition of two adjacent characters as one edit.
+func distance(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func minInt(a int, b ...int) int {
+	for _, v := range b {
+		if v < a {
+			a = v
+		}
+	}
+	return a
+}
@@ -1,7 +1,11 @@
 package gen
 
 import (
+	"bufio"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/oshima/lang/ast"
 	"github.com/oshima/lang/token"
@@ -10,23 +14,129 @@ import (
 
 // emitter emits the target assembly code.
 type emitter struct {
+	w     *bufio.Writer
 	gvars map[ast.Decl]*gvar
 	grans map[ast.Expr]*gran
 	garrs map[ast.Expr]*garr
+	grecs map[ast.Expr]*grec
 	lvars map[ast.Decl]*lvar
 	lrans map[ast.Expr]*lran
 	larrs map[ast.Expr]*larr
+	lrecs map[ast.Expr]*lrec
 	strs  map[ast.Expr]*str
+	fmts  map[ast.Expr]*fmtv
 	fns   map[ast.Node]*fn
 	brs   map[ast.Node]*br
 }
 
 func (e *emitter) emit(format string, a ...interface{}) {
-	fmt.Printf("\t"+format+"\n", a...)
+	fmt.Fprintf(e.w, "\t"+format+"\n", a...)
 }
 
 func (e *emitter) emitLabel(label string) {
-	fmt.Println(label + ":")
+	fmt.Fprintln(e.w, label+":")
+}
+
+// emitMove moves the value between the registers, either of which may be xmm register.
+func (e *emitter) emitMove(dst string, src string) {
+	switch {
+	case dst == src:
+		// do nothing
+	case strings.HasPrefix(dst, "xmm") || strings.HasPrefix(src, "xmm"):
+		e.emit("movq %s, %s", dst, src)
+	default:
+		e.emit("mov %s, %s", dst, src)
+	}
+}
+
+// emitLoad loads the value of the type at the address into rax.
+// A struct, tuple or enum is not loaded, but represented by its address.
+// The values smaller than 8 bytes are extended by their signs or zeros.
+func (e *emitter) emitLoad(typ types.Type, addr string) {
+	if inMemory(typ) {
+		e.emit("lea rax, %s", addr)
+		return
+	}
+	switch size := sizeOf(typ); {
+	case size == 8:
+		e.emit("mov rax, qword ptr %s", addr)
+	case size == 4 && signed(typ):
+		e.emit("movsxd rax, dword ptr %s", addr)
+	case size == 4:
+		e.emit("mov eax, dword ptr %s", addr) // zero-extended implicitly
+	case signed(typ):
+		e.emit("movsx rax, %s ptr %s", ptrs[size], addr)
+	default:
+		e.emit("movzx rax, %s ptr %s", ptrs[size], addr)
+	}
+}
+
+// emitExtend extends the lower part of rax for the sized integer type or char to 64 bits,
+// which keeps the value in rax same as the one loaded after the operations overflowing the size.
+func (e *emitter) emitExtend(typ types.Type) {
+	if _, ok := types.Underlying(typ).(*types.Char); ok {
+		e.emit("mov eax, eax")
+		return
+	}
+	v, ok := types.Underlying(typ).(*types.Int)
+	if !ok || v.Size == 0 || v.Size == 8 {
+		return
+	}
+	switch {
+	case v.Size == 4 && v.Unsigned:
+		e.emit("mov eax, eax")
+	case v.Size == 4:
+		e.emit("movsxd rax, eax")
+	case v.Unsigned:
+		e.emit("movzx rax, %s", raxParts[v.Size])
+	default:
+		e.emit("movsx rax, %s", raxParts[v.Size])
+	}
+}
+
+// emitStore stores the value of the type in rax to the address.
+// A struct, tuple or enum is copied from the address in rax, which breaks rcx, rsi and rdi.
+func (e *emitter) emitStore(typ types.Type, addr string) {
+	if inMemory(typ) {
+		e.emit("mov rsi, rax")
+		e.emit("lea rdi, %s", addr)
+		e.emit("mov rcx, %d", sizeOf(typ))
+		e.emit("rep movsb")
+		return
+	}
+	size := sizeOf(typ)
+	e.emit("mov %s ptr %s, %s", ptrs[size], addr, raxParts[size])
+}
+
+// elemAddr returns the address of the element at the index rcx in the array at rax.
+func (e *emitter) elemAddr(elemType types.Type) string {
+	switch size := sizeOf(elemType); size {
+	case 1:
+		return "[rax+rcx]"
+	case 2, 4, 8:
+		return fmt.Sprintf("[rax+rcx*%d]", size)
+	default:
+		e.emit("imul rcx, rcx, %d", size)
+		return "[rax+rcx]"
+	}
+}
+
+// imm returns the integer as an operand of instruction.
+// The integer not fitting in 32 bits is moved to rdx instead.
+func (e *emitter) imm(n int) string {
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		e.emit("mov rdx, %d", n)
+		return "rdx"
+	}
+	return strconv.Itoa(n)
+}
+
+// varAddr returns the address of the variable.
+func (e *emitter) varAddr(decl *ast.VarDecl) string {
+	if lvar, ok := e.lvars[decl]; ok {
+		return fmt.Sprintf("[rbp-%d]", lvar.offset)
+	}
+	return e.gvars[decl].label + "[rip]"
 }
 
 // ----------------------------------------------------------------
@@ -35,31 +145,76 @@ func (e *emitter) emitLabel(label string) {
 func (e *emitter) emitProgram(prog *ast.Program) {
 	e.emit(".intel_syntax noprefix")
 
-	if len(e.strs) > 0 {
+	// iterate over the maps in the order of the source code for reproducible output
+	var nodes []ast.Node
+
+	if len(e.strs) > 0 || len(e.fmts) > 0 {
 		e.emit(".section .rodata")
 	}
-	for _, str := range e.strs {
+	nodes = nodes[:0]
+	for expr := range e.strs {
+		nodes = append(nodes, expr)
+	}
+	for _, node := range sortNodes(nodes, func(n ast.Node) string { return e.strs[n.(ast.Expr)].label }) {
+		str := e.strs[node.(ast.Expr)]
 		e.emitLabel(str.label)
-		e.emit(".string %q", str.value)
+		e.emit(".string %s", quote(str.value))
+	}
+	if len(e.fmts) > 0 {
+		for _, str := range fmtStrs {
+			e.emitLabel(str.label)
+			e.emit(".string %s", quote(str.value))
+		}
 	}
 
 	e.emit(".text")
 
-	for _, gvar := range e.gvars {
-		e.emit(".comm %s,%d,%d", gvar.label, gvar.size, gvar.size)
+	nodes = nodes[:0]
+	for decl := range e.gvars {
+		nodes = append(nodes, decl)
+	}
+	for _, node := range sortNodes(nodes, func(n ast.Node) string { return e.gvars[n.(ast.Decl)].label }) {
+		gvar := e.gvars[node.(ast.Decl)]
+		e.emit(".comm %s,%d,%d", gvar.label, gvar.size, gvar.align)
 	}
 
-	for _, gran := range e.grans {
+	nodes = nodes[:0]
+	for expr := range e.grans {
+		nodes = append(nodes, expr)
+	}
+	for _, node := range sortNodes(nodes, func(n ast.Node) string { return e.grans[n.(ast.Expr)].label }) {
+		gran := e.grans[node.(ast.Expr)]
 		e.emit(".comm %s,%d,%d", gran.label, 16, 8)
 	}
 
-	for _, garr := range e.garrs {
-		e.emit(".comm %s,%d,%d", garr.label, garr.len*garr.elemSize, garr.elemSize)
+	nodes = nodes[:0]
+	for expr := range e.garrs {
+		nodes = append(nodes, expr)
+	}
+	for _, node := range sortNodes(nodes, func(n ast.Node) string { return e.garrs[n.(ast.Expr)].label }) {
+		garr := e.garrs[node.(ast.Expr)]
+		e.emit(".comm %s,%d,%d", garr.label, garr.len*garr.elemSize, garr.elemAlign)
+	}
+
+	nodes = nodes[:0]
+	for expr := range e.grecs {
+		nodes = append(nodes, expr)
+	}
+	for _, node := range sortNodes(nodes, func(n ast.Node) string { return e.grecs[n.(ast.Expr)].label }) {
+		grec := e.grecs[node.(ast.Expr)]
+		e.emit(".comm %s,%d,%d", grec.label, grec.size, grec.align)
 	}
 
+	nodes = nodes[:0]
 	for node := range e.fns {
+		nodes = append(nodes, node)
+	}
+	for _, node := range sortNodes(nodes, func(n ast.Node) string { return e.fns[n].label }) {
 		e.emitFunc(node)
 	}
+	if len(e.fmts) > 0 {
+		e.emitFmtChar()
+	}
 
 	e.emit(".global main")
 	e.emitLabel("main")
@@ -97,14 +252,52 @@ func (e *emitter) emitFunc(node ast.Node) {
 		e.emit("sub rsp, %d", fn.localArea)
 	}
 
+	// the hidden pointer comes first
+	shift := 0
+	if fn.retOffset > 0 {
+		e.emit("mov qword ptr [rbp-%d], rdi", fn.retOffset)
+		shift = 1
+	}
+
+	var typs []types.Type
+	for _, param := range params {
+		typs = append(typs, param.VarType)
+	}
+	indexes := paramIndexes(typs, shift)
+
+	// structs, tuples and enums are given by their addresses, and copied after
+	// the other parameters since copying breaks the registers
+	var recs []*ast.VarDecl
+	stack := 0 // number of parameters on the stack, above the return address
 	for i, param := range params {
 		lvar := e.lvars[param]
-		switch lvar.size {
-		case 1:
-			e.emit("mov byte ptr [rbp-%d], %s", lvar.offset, paramRegs[1][i])
-		case 8:
-			e.emit("mov qword ptr [rbp-%d], %s", lvar.offset, paramRegs[8][i])
+		if indexes[i] < 0 {
+			addr := fmt.Sprintf("[rbp+%d]", 16+stack*8)
+			stack++
+			if inMemory(param.VarType) {
+				e.emit("push qword ptr %s", addr)
+				recs = append(recs, param)
+				continue
+			}
+			e.emit("mov rax, qword ptr %s", addr)
+			e.emit("mov %s ptr [rbp-%d], %s", ptrs[lvar.size], lvar.offset, raxParts[lvar.size])
+			continue
+		}
+		if inMemory(param.VarType) {
+			e.emit("push %s", paramRegs[8][indexes[i]])
+			recs = append(recs, param)
+			continue
 		}
+		if isFloat(param.VarType) {
+			e.emit("movsd qword ptr [rbp-%d], %s", lvar.offset, xmmRegs[indexes[i]])
+			continue
+		}
+		e.emit("mov %s ptr [rbp-%d], %s", ptrs[lvar.size], lvar.offset, paramRegs[lvar.size][indexes[i]])
+	}
+	for i := range recs {
+		param := recs[len(recs)-1-i] // reverse order
+		e.emit("pop rax")
+		e.emitStore(param.VarType, e.varAddr(param))
 	}
 
 	e.emitBlockStmt(body)
@@ -129,6 +322,8 @@ func (e *emitter) emitStmt(stmt ast.Stmt) {
 		e.emitWhileStmt(v)
 	case *ast.ForStmt:
 		e.emitForStmt(v)
+	case *ast.MatchStmt:
+		e.emitMatchStmt(v)
 	case *ast.ReturnStmt:
 		e.emitReturnStmt(v)
 	case *ast.ContinueStmt:
@@ -149,39 +344,43 @@ func (e *emitter) emitBlockStmt(stmt *ast.BlockStmt) {
 }
 
 func (e *emitter) emitVarStmt(stmt *ast.VarStmt) {
-	for _, v := range stmt.Vars {
-		e.emitExpr(v.Value)
+	if stmt.Value != nil {
+		e.emitExpr(stmt.Value)
+		e.emit("mov rdx, rax") // rdx: address of tuple
 
-		if lvar, ok := e.lvars[v]; ok {
-			switch lvar.size {
-			case 1:
-				e.emit("mov byte ptr [rbp-%d], al", lvar.offset)
-			case 8:
-				e.emit("mov qword ptr [rbp-%d], rax", lvar.offset)
-			}
-		} else if gvar, ok := e.gvars[v]; ok {
-			switch gvar.size {
-			case 1:
-				e.emit("mov byte ptr %s[rip], al", gvar.label)
-			case 8:
-				e.emit("mov qword ptr %s[rip], rax", gvar.label)
-			}
+		offsets := offsetsOf(stmt.Value.Type())
+		for i, v := range stmt.Vars {
+			e.emitLoad(v.VarType, fmt.Sprintf("[rdx+%d]", offsets[i]))
+			e.emitStore(v.VarType, e.varAddr(v))
 		}
+		return
+	}
+
+	for _, v := range stmt.Vars {
+		e.emitExpr(v.Value)
+		e.emitStore(v.VarType, e.varAddr(v))
 	}
 }
 
 func (e *emitter) emitIfStmt(stmt *ast.IfStmt) {
 	br := e.brs[stmt]
 
-	e.emitExpr(stmt.Cond)
-	e.emit("cmp rax, 0")
+	if stmt.Var != nil {
+		e.emitExpr(stmt.Var.Value)
+		e.emitNone(stmt.Var.Value.Type())
+	} else {
+		e.emitExpr(stmt.Cond)
+		e.emit("cmp rax, 0")
+	}
 
 	if stmt.Else == nil {
 		e.emit("je %s", br.endLabel)
+		e.emitUnwrap(stmt.Var)
 		e.emitBlockStmt(stmt.Body)
 		e.emitLabel(br.endLabel)
 	} else {
 		e.emit("je %s", br.elseLabel)
+		e.emitUnwrap(stmt.Var)
 		e.emitBlockStmt(stmt.Body)
 		e.emit("jmp %s", br.endLabel)
 		e.emitLabel(br.elseLabel)
@@ -190,6 +389,27 @@ func (e *emitter) emitIfStmt(stmt *ast.IfStmt) {
 	}
 }
 
+// emitNone sets ZF if the option in rax is none.
+func (e *emitter) emitNone(typ types.Type) {
+	if inMemory(typ) {
+		e.emit("cmp byte ptr [rax], 0")
+	} else {
+		e.emit("cmp rax, 0")
+	}
+}
+
+// emitUnwrap stores the content of the option in rax to the variable of if var.
+func (e *emitter) emitUnwrap(decl *ast.VarDecl) {
+	if decl == nil {
+		return
+	}
+	if typ := decl.Value.Type(); inMemory(typ) {
+		offsets := offsetsOf(typ)
+		e.emitLoad(decl.VarType, fmt.Sprintf("[rax+%d]", offsets[1]))
+	}
+	e.emitStore(decl.VarType, e.varAddr(decl))
+}
+
 func (e *emitter) emitWhileStmt(stmt *ast.WhileStmt) {
 	br := e.brs[stmt]
 
@@ -205,7 +425,7 @@ func (e *emitter) emitWhileStmt(stmt *ast.WhileStmt) {
 func (e *emitter) emitForStmt(stmt *ast.ForStmt) {
 	br := e.brs[stmt]
 
-	switch typ := stmt.Iter.VarType.(type) {
+	switch typ := types.Underlying(stmt.Iter.VarType).(type) {
 	case *types.Range:
 		if elem, ok := e.lvars[stmt.Elem]; ok {
 			index := e.lvars[stmt.Index]
@@ -279,14 +499,8 @@ func (e *emitter) emitForStmt(stmt *ast.ForStmt) {
 			e.emit("jge %s", br.endLabel)
 
 			// pre
-			switch elem.size {
-			case 1:
-				e.emit("mov al, byte ptr [rax+rcx]")
-				e.emit("mov byte ptr [rbp-%d], al", elem.offset)
-			case 8:
-				e.emit("mov rax, qword ptr [rax+rcx*8]")
-				e.emit("mov qword ptr [rbp-%d], rax", elem.offset)
-			}
+			e.emitLoad(typ.ElemType, e.elemAddr(typ.ElemType))
+			e.emitStore(typ.ElemType, fmt.Sprintf("[rbp-%d]", elem.offset))
 
 			// body
 			e.emitBlockStmt(stmt.Body)
@@ -314,14 +528,8 @@ func (e *emitter) emitForStmt(stmt *ast.ForStmt) {
 			e.emit("jge %s", br.endLabel)
 
 			// pre
-			switch elem.size {
-			case 1:
-				e.emit("mov al, byte ptr [rax+rcx]")
-				e.emit("mov byte ptr %s[rip], al", elem.label)
-			case 8:
-				e.emit("mov rax, qword ptr [rax+rcx*8]")
-				e.emit("mov qword ptr %s[rip], rax", elem.label)
-			}
+			e.emitLoad(typ.ElemType, e.elemAddr(typ.ElemType))
+			e.emitStore(typ.ElemType, elem.label+"[rip]")
 
 			// body
 			e.emitBlockStmt(stmt.Body)
@@ -334,9 +542,264 @@ func (e *emitter) emitForStmt(stmt *ast.ForStmt) {
 			e.emit("jmp %s", br.beginLabel)
 			e.emitLabel(br.endLabel)
 		}
+	case *types.Slice:
+		// the length is read at each iteration, which includes the elements appended in the body
+		elem := e.varAddr(stmt.Elem)
+		index := e.varAddr(stmt.Index)
+		iter := e.varAddr(stmt.Iter)
+
+		// init
+		e.emitExpr(stmt.Iter.Value)
+		e.emit("mov qword ptr %s, rax", iter)
+		e.emit("mov qword ptr %s, 0", index)
+
+		// cond
+		e.emitLabel(br.beginLabel)
+		e.emit("mov rax, qword ptr %s", iter)
+		e.emit("mov rcx, qword ptr %s", index)
+		e.emit("cmp rcx, qword ptr [rax+8]")
+		e.emit("jge %s", br.endLabel)
+
+		// pre
+		e.emit("mov rax, qword ptr [rax]")
+		e.emitLoad(typ.ElemType, e.elemAddr(typ.ElemType))
+		e.emitStore(typ.ElemType, elem)
+
+		// body
+		e.emitBlockStmt(stmt.Body)
+
+		// post
+		e.emitLabel(br.continueLabel)
+		e.emit("inc qword ptr %s", index)
+		e.emit("jmp %s", br.beginLabel)
+		e.emitLabel(br.endLabel)
+	case *types.String:
+		// the implicit variable points to the next character
+		elem := e.varAddr(stmt.Elem)
+		index := e.varAddr(stmt.Index)
+		iter := e.varAddr(stmt.Iter)
+
+		// init
+		e.emitExpr(stmt.Iter.Value)
+		e.emit("mov qword ptr %s, rax", iter)
+		e.emit("mov qword ptr %s, 0", index)
+
+		// cond
+		e.emitLabel(br.beginLabel)
+		e.emit("mov rdx, qword ptr %s", iter)
+		e.emit("cmp byte ptr [rdx], 0")
+		e.emit("je %s", br.endLabel)
+
+		// pre
+		e.emitDecode(br)
+		e.emit("add qword ptr %s, rcx", iter)
+		e.emit("mov dword ptr %s, eax", elem)
+
+		// body
+		e.emitBlockStmt(stmt.Body)
+
+		// post
+		e.emitLabel(br.continueLabel)
+		e.emit("inc qword ptr %s", index)
+		e.emit("jmp %s", br.beginLabel)
+		e.emitLabel(br.endLabel)
 	}
 }
 
+// emitDecode decodes the UTF-8 character at rdx into eax, and its width in bytes into rcx.
+// The invalid bytes give U+FFFD one by one, without reading beyond the terminating null.
+func (e *emitter) emitDecode(br *br) {
+	e.emit("movzx eax, byte ptr [rdx]") // leading byte
+	e.emit("mov esi, 1")                // esi: width
+	e.emit("cmp eax, 0x80")
+	e.emit("jb %s", br.doneLabel)
+
+	// the leading ones tell the width, which is 7 minus the index of the highest zero
+	e.emit("mov r8d, eax")
+	e.emit("xor r8d, 0xff")
+	e.emit("jz %s", br.invalidLabel)
+	e.emit("bsr r8d, r8d")
+	e.emit("neg r8d")
+	e.emit("add r8d, 7") // r8d: expected width
+	e.emit("cmp r8d, 2")
+	e.emit("jb %s", br.invalidLabel)
+	e.emit("cmp r8d, 4")
+	e.emit("ja %s", br.invalidLabel)
+
+	// append 6 bits of each continuation byte
+	e.emitLabel(br.loopLabel)
+	e.emit("cmp esi, r8d")
+	e.emit("jae %s", br.trimLabel)
+	e.emit("movzx ecx, byte ptr [rdx+rsi]")
+	e.emit("mov edi, ecx")
+	e.emit("and edi, 0xc0")
+	e.emit("cmp edi, 0x80")
+	e.emit("jne %s", br.invalidLabel)
+	e.emit("shl eax, 6")
+	e.emit("and ecx, 0x3f")
+	e.emit("or eax, ecx")
+	e.emit("inc esi")
+	e.emit("jmp %s", br.loopLabel)
+
+	// clear the bits marking the width, leaving 5 * width + 1 bits
+	e.emitLabel(br.trimLabel)
+	e.emit("lea ecx, [rsi+rsi*4+1]")
+	e.emit("mov edi, 1")
+	e.emit("shl edi, cl")
+	e.emit("dec edi")
+	e.emit("and eax, edi")
+
+	// reject the overlong encodings, which are shorter with fewer bytes
+	e.emit("mov edi, 0x80")
+	e.emit("mov ecx, 0x800")
+	e.emit("cmp esi, 3")
+	e.emit("cmove edi, ecx")
+	e.emit("mov ecx, 0x10000")
+	e.emit("cmova edi, ecx") // edi: minimum for the width
+	e.emit("cmp eax, edi")
+	e.emit("jb %s", br.invalidLabel)
+
+	// reject the surrogates and the values beyond the last code point
+	e.emit("mov edi, eax")
+	e.emit("and edi, -0x800")
+	e.emit("cmp edi, 0xd800")
+	e.emit("je %s", br.invalidLabel)
+	e.emit("cmp eax, 0x10ffff")
+	e.emit("ja %s", br.invalidLabel)
+	e.emit("jmp %s", br.doneLabel)
+
+	e.emitLabel(br.invalidLabel)
+	e.emit("mov eax, 0xfffd")
+	e.emit("mov esi, 1")
+
+	e.emitLabel(br.doneLabel)
+	e.emit("mov ecx, esi")
+}
+
+func (e *emitter) emitMatchStmt(stmt *ast.MatchStmt) {
+	br := e.brs[stmt]
+
+	// the values matching no pattern go to _ if any
+	defaultLabel := br.endLabel
+	for _, arm := range stmt.Arms {
+		if arm.Patterns == nil {
+			defaultLabel = e.brs[arm].beginLabel
+			break
+		}
+	}
+
+	e.emitExpr(stmt.Value)
+
+	switch types.Underlying(stmt.Value.Type()).(type) {
+	case *types.Int:
+		if br.tableLabel != "" {
+			min, max, _ := jumpTable(stmt)
+			labels := make([]string, max-min+1)
+			for i := range labels {
+				labels[i] = defaultLabel
+			}
+			for i := len(stmt.Arms) - 1; i >= 0; i-- {
+				for _, pat := range stmt.Arms[i].Patterns {
+					n, _ := ast.IntValue(pat)
+					labels[n-min] = e.brs[stmt.Arms[i]].beginLabel
+				}
+			}
+
+			e.emit("sub rax, %s", e.imm(min))
+			e.emit("cmp rax, %s", e.imm(max-min))
+			e.emit("ja %s", defaultLabel)
+			e.emit("jmp qword ptr [%s+rax*8]", br.tableLabel)
+			e.emit(".section .rodata")
+			e.emit(".align 8")
+			e.emitLabel(br.tableLabel)
+			for _, label := range labels {
+				e.emit(".quad %s", label)
+			}
+			e.emit(".text")
+			break
+		}
+
+		for _, arm := range stmt.Arms {
+			for _, pat := range arm.Patterns {
+				if n, ok := ast.IntValue(pat); ok {
+					e.emit("cmp rax, %s", e.imm(n))
+					e.emit("je %s", e.brs[arm].beginLabel)
+					continue
+				}
+				// lower <= rax < upper, compared as unsigned after subtracting lower
+				v := pat.(*ast.RangeLit)
+				lower, _ := ast.IntValue(v.Lower)
+				upper, _ := ast.IntValue(v.Upper)
+				if lower >= upper {
+					continue // empty
+				}
+				e.emit("mov rcx, rax")
+				e.emit("sub rcx, %s", e.imm(lower))
+				e.emit("cmp rcx, %s", e.imm(upper-lower))
+				e.emit("jb %s", e.brs[arm].beginLabel)
+			}
+		}
+		e.emit("jmp %s", defaultLabel)
+	case *types.String:
+		// the string is kept on the stack while calling strcmp,
+		// and dropped at the beginning of each arm
+		e.emit("sub rsp, 16")
+		e.emit("mov qword ptr [rsp], rax")
+		for _, arm := range stmt.Arms {
+			for _, pat := range arm.Patterns {
+				str := e.strs[pat]
+				e.emit("mov rdi, qword ptr [rsp]")
+				e.emit("mov rsi, offset flat:%s", str.label)
+				e.emitCall("strcmp")
+				e.emit("cmp eax, 0")
+				e.emit("je %s", e.brs[arm].beginLabel)
+			}
+		}
+		if defaultLabel == br.endLabel {
+			e.emit("add rsp, 16")
+		}
+		e.emit("jmp %s", defaultLabel)
+	case *types.Enum:
+		// rax: address of enum
+		e.emit("mov rcx, qword ptr [rax]") // rcx: tag
+		for _, arm := range stmt.Arms {
+			for _, pat := range arm.Patterns {
+				v := pat.(*ast.VariantPattern)
+				e.emit("cmp rcx, %d", v.Type().(*types.Enum).Variant(v.Name))
+				e.emit("je %s", e.brs[arm].beginLabel)
+			}
+		}
+		e.emit("jmp %s", defaultLabel)
+	}
+
+	for _, arm := range stmt.Arms {
+		e.emitLabel(e.brs[arm].beginLabel)
+		if _, ok := types.Underlying(stmt.Value.Type()).(*types.String); ok {
+			e.emit("add rsp, 16")
+		}
+		for _, pat := range arm.Patterns {
+			v, ok := pat.(*ast.VariantPattern)
+			if !ok {
+				continue
+			}
+			e.emit("mov rdx, rax") // rdx: address of enum
+
+			enum := v.Type().(*types.Enum)
+			offsets := payloadOffsets(enum.Variants[enum.Variant(v.Name)].Payload)
+			for i, binding := range v.Bindings {
+				if binding.Name == "_" {
+					continue
+				}
+				e.emitLoad(binding.VarType, fmt.Sprintf("[rdx+%d]", offsets[i]))
+				e.emitStore(binding.VarType, e.varAddr(binding))
+			}
+		}
+		e.emitBlockStmt(arm.Body)
+		e.emit("jmp %s", br.endLabel)
+	}
+	e.emitLabel(br.endLabel)
+}
+
 func (e *emitter) emitContinueStmt(stmt *ast.ContinueStmt) {
 	br := e.brs[stmt.Ref]
 
@@ -365,6 +828,29 @@ func (e *emitter) emitReturnStmt(stmt *ast.ReturnStmt) {
 	if stmt.Value != nil {
 		e.emitExpr(stmt.Value)
 	}
+	if fn := e.fns[stmt.Ref]; fn.retOffset > 0 {
+		// copy the value to the storage given by the caller
+		e.emit("mov rdx, qword ptr [rbp-%d]", fn.retOffset)
+		e.emitStore(stmt.Value.Type(), "[rdx]")
+		e.emit("mov rax, rdx")
+	} else if stmt.Value != nil && inRegs(stmt.Value.Type()) {
+		typ := types.Underlying(stmt.Value.Type()).(*types.Tuple)
+		offsets := offsetsOf(typ)
+		regs := retRegs(typ.ElemTypes)
+		e.emit("mov rcx, rax") // rcx: address of tuple
+
+		// the element returned in rax is loaded last
+		order := []int{1, 0}
+		if regs[1] == "rax" {
+			order = []int{0, 1}
+		}
+		for _, i := range order {
+			e.emitLoad(typ.ElemTypes[i], fmt.Sprintf("[rcx+%d]", offsets[i]))
+			e.emitMove(regs[i], "rax")
+		}
+	} else if stmt.Value != nil && isFloat(stmt.Value.Type()) {
+		e.emitMove("xmm0", "rax")
+	}
 	e.emit("jmp %s", br.endLabel)
 }
 
@@ -385,41 +871,72 @@ func (e *emitter) emitAssignStmt(stmt *ast.AssignStmt) {
 			value.Op = token.SLASH
 		case token.MODASSIGN:
 			value.Op = token.PERCENT
+		case token.ANDASSIGN:
+			value.Op = token.AMP
+		case token.ORASSIGN:
+			value.Op = token.PIPE
+		case token.XORASSIGN:
+			value.Op = token.CARET
+		case token.SHLASSIGN:
+			value.Op = token.SHL
+		case token.SHRASSIGN:
+			value.Op = token.SHR
 		}
 		e.emitExpr(value)
 	}
 
-	switch v := stmt.Target.(type) {
-	case *ast.Ident:
-		if lvar, ok := e.lvars[v.Ref.(*ast.VarDecl)]; ok {
-			switch lvar.size {
-			case 1:
-				e.emit("mov byte ptr [rbp-%d], al", lvar.offset)
-			case 8:
-				e.emit("mov qword ptr [rbp-%d], rax", lvar.offset)
-			}
-		} else if gvar, ok := e.gvars[v.Ref.(*ast.VarDecl)]; ok {
-			switch gvar.size {
-			case 1:
-				e.emit("mov byte ptr %s[rip], al", gvar.label)
-			case 8:
-				e.emit("mov qword ptr %s[rip], rax", gvar.label)
-			}
+	if v, ok := stmt.Target.(*ast.TupleLit); ok {
+		// the addresses of all the targets are evaluated before assigning to any of them
+		offsets := offsetsOf(stmt.Value.Type())
+		n := len(v.Elems)
+		e.emit("push rax") // address of tuple
+		for _, target := range v.Elems {
+			e.emitAddr(target)
+			e.emit("push rax")
+		}
+		for i, target := range v.Elems {
+			e.emit("mov rax, qword ptr [rsp+%d]", n*8)
+			e.emitLoad(target.Type(), fmt.Sprintf("[rax+%d]", offsets[i]))
+			e.emit("mov rdx, qword ptr [rsp+%d]", (n-1-i)*8)
+			e.emitStore(target.Type(), "[rdx]")
 		}
+		e.emit("add rsp, %d", n*8)
+		e.emit("pop rax")
+		return
+	}
+	e.emitAssign(stmt.Target)
+}
+
+// emitAssign stores the value in rax to the target.
+func (e *emitter) emitAssign(target ast.Expr) {
+	if v, ok := target.(*ast.Ident); ok {
+		e.emitStore(v.Type(), e.varAddr(v.Ref.(*ast.VarDecl)))
+		return
+	}
+	e.emit("push rax")
+	e.emitAddr(target)
+	e.emit("mov rdx, rax")
+	e.emit("pop rax") // rax: value
+	e.emitStore(target.Type(), "[rdx]")
+}
+
+// emitAddr evaluates the address of the target into rax.
+func (e *emitter) emitAddr(target ast.Expr) {
+	switch v := target.(type) {
+	case *ast.Ident:
+		e.emit("lea rax, %s", e.varAddr(v.Ref.(*ast.VarDecl)))
 	case *ast.IndexExpr:
-		e.emit("push rax")
 		e.emitExpr(v.Index)
 		e.emit("push rax")
 		e.emitExpr(v.Left) // rax: address of array head
-		e.emit("pop rcx")  // rcx: index
-		e.emit("pop rdx")  // rdx: value
-
-		switch sizeOf(stmt.Value.Type()) {
-		case 1:
-			e.emit("mov byte ptr [rax+rcx], dl")
-		case 8:
-			e.emit("mov qword ptr [rax+rcx*8], rdx")
+		if isSlice(v.Left.Type()) {
+			e.emit("mov rax, qword ptr [rax]")
 		}
+		e.emit("pop rcx") // rcx: index
+		e.emit("lea rax, %s", e.elemAddr(v.Type()))
+	case *ast.FieldExpr:
+		e.emitExpr(v.Left) // rax: address of struct
+		e.emit("lea rax, [rax+%d]", offsetOf(types.Underlying(v.Left.Type()).(*types.Struct), v.Name))
 	}
 }
 
@@ -438,16 +955,28 @@ func (e *emitter) emitExpr(expr ast.Expr) {
 		e.emitInfixExpr(v)
 	case *ast.IndexExpr:
 		e.emitIndexExpr(v)
+	case *ast.FieldExpr:
+		e.emitFieldExpr(v)
 	case *ast.CallExpr:
 		e.emitCallExpr(v)
 	case *ast.LibCallExpr:
 		e.emitLibCallExpr(v)
 	case *ast.Ident:
 		e.emitIdent(v)
+	case *ast.StructLit:
+		e.emitStructLit(v)
 	case *ast.IntLit:
 		e.emitIntLit(v)
+	case *ast.FloatLit:
+		e.emitFloatLit(v)
+	case *ast.CharLit:
+		e.emitCharLit(v)
 	case *ast.BoolLit:
 		e.emitBoolLit(v)
+	case *ast.NoneLit:
+		e.emitNoneLit(v)
+	case *ast.SomeExpr:
+		e.emitSomeExpr(v)
 	case *ast.StringLit:
 		e.emitStringLit(v)
 	case *ast.RangeLit:
@@ -456,6 +985,10 @@ func (e *emitter) emitExpr(expr ast.Expr) {
 		e.emitArrayLit(v)
 	case *ast.ArrayShortLit:
 		e.emitArrayShortLit(v)
+	case *ast.SliceLit:
+		e.emitSliceLit(v)
+	case *ast.TupleLit:
+		e.emitTupleLit(v)
 	case *ast.FuncLit:
 		e.emitFuncLit(v)
 	}
@@ -467,12 +1000,32 @@ func (e *emitter) emitPrefixExpr(expr *ast.PrefixExpr) {
 	switch expr.Op {
 	case token.BANG:
 		e.emit("xor rax, 1")
+	case token.TILDE:
+		e.emit("not rax")
+		e.emitExtend(expr.Type())
 	case token.MINUS:
-		e.emit("neg rax")
+		if isFloat(expr.Type()) {
+			e.emit("btc rax, 63") // flip the sign bit
+		} else {
+			e.emit("neg rax")
+			e.emitExtend(expr.Type())
+		}
 	}
 }
 
 func (e *emitter) emitInfixExpr(expr *ast.InfixExpr) {
+	if opt, ok := ast.NoneOperand(expr); ok {
+		e.emitExpr(opt)
+		e.emitNone(opt.Type())
+		if expr.Op == token.EQ {
+			e.emit("sete al")
+		} else {
+			e.emit("setne al")
+		}
+		e.emit("movzx rax, al")
+		return
+	}
+
 	switch expr.Op {
 	case token.AND, token.OR:
 		// do nothing
@@ -485,23 +1038,68 @@ func (e *emitter) emitInfixExpr(expr *ast.InfixExpr) {
 		e.emit("pop rax")      // rax: left
 	}
 
+	if isFloat(expr.Left.Type()) && expr.Op != token.IN {
+		e.emitFloatOp(expr.Op)
+		return
+	}
+	if isString(expr.Left.Type()) && expr.Op != token.IN {
+		e.emitStringOp(expr.Op)
+		return
+	}
 	switch expr.Op {
 	case token.PLUS:
 		e.emit("add rax, rcx")
+		e.emitExtend(expr.Left.Type())
 	case token.MINUS:
 		e.emit("sub rax, rcx")
+		e.emitExtend(expr.Left.Type())
 	case token.ASTERISK:
 		e.emit("imul rax, rcx")
-	case token.SLASH:
-		e.emit("cqo")
-		e.emit("idiv rcx")
-	case token.PERCENT:
-		e.emit("cqo")
-		e.emit("idiv rcx")
-		e.emit("mov rax, rdx")
+		e.emitExtend(expr.Left.Type())
+	case token.SLASH, token.PERCENT:
+		if unsigned(expr.Left.Type()) {
+			e.emit("mov rdx, 0")
+			e.emit("div rcx")
+		} else {
+			e.emit("cqo")
+			e.emit("idiv rcx")
+		}
+		if expr.Op == token.PERCENT {
+			e.emit("mov rax, rdx")
+		}
+		e.emitExtend(expr.Left.Type())
+	case token.AMP:
+		e.emit("and rax, rcx")
+	case token.PIPE:
+		e.emit("or rax, rcx")
+	case token.CARET:
+		e.emit("xor rax, rcx")
+	case token.SHL, token.SHR:
+		if expr.Op == token.SHR && !unsigned(expr.Left.Type()) {
+			// the count over 63 fills all bits with the sign
+			e.emit("mov rdx, 63")
+			e.emit("cmp rcx, rdx")
+			e.emit("cmova rcx, rdx")
+			e.emit("sar rax, cl")
+		} else {
+			// the count over 63 shifts out all bits
+			e.emit("cmp rcx, 64")
+			e.emit("sbb rdx, rdx")
+			if expr.Op == token.SHL {
+				e.emit("shl rax, cl")
+			} else {
+				e.emit("shr rax, cl")
+			}
+			e.emit("and rax, rdx")
+		}
+		e.emitExtend(expr.Left.Type())
 	case token.EQ, token.NE, token.LT, token.LE, token.GT, token.GE:
 		e.emit("cmp rax, rcx")
-		e.emit("%s al", setcc[expr.Op])
+		if unsigned(expr.Left.Type()) {
+			e.emit("%s al", unsignedSetcc[expr.Op])
+		} else {
+			e.emit("%s al", setcc[expr.Op])
+		}
 		e.emit("movzx rax, al")
 	case token.AND:
 		br := e.brs[expr]
@@ -520,7 +1118,7 @@ func (e *emitter) emitInfixExpr(expr *ast.InfixExpr) {
 		e.emitExpr(expr.Right)
 		e.emitLabel(br.endLabel)
 	case token.IN:
-		switch v := expr.Right.Type().(type) {
+		switch v := types.Underlying(expr.Right.Type()).(type) {
 		case *types.Range:
 			br := e.brs[expr]
 
@@ -533,108 +1131,740 @@ func (e *emitter) emitInfixExpr(expr *ast.InfixExpr) {
 			e.emitLabel(br.falseLabel)
 			e.emit("mov rax, 0")
 			e.emitLabel(br.endLabel)
+		case *types.String:
+			e.emit("mov rdi, rcx")
+			e.emit("mov rsi, rax")
+			e.emitCall("strstr")
+			e.emit("cmp rax, 0")
+			e.emit("setne al")
+			e.emit("movzx rax, al")
 		case *types.Array:
-			br := e.brs[expr]
+			e.emit("lea rdx, [rcx+%d]", v.Len*sizeOf(v.ElemType))
+			e.emitElemSearch(v.ElemType, e.brs[expr])
+		case *types.Slice:
+			e.emit("mov rdx, qword ptr [rcx+8]")
+			e.emit("imul rdx, rdx, %d", sizeOf(v.ElemType))
+			e.emit("mov rcx, qword ptr [rcx]")
+			e.emit("add rdx, rcx")
+			e.emitElemSearch(v.ElemType, e.brs[expr])
+		}
+	}
+}
 
-			len := v.Len
-			elemSize := sizeOf(v.ElemType)
+// emitElemSearch searches the elements from rcx to rdx for the value in rax.
+func (e *emitter) emitElemSearch(elemType types.Type, br *br) {
+	elemSize := sizeOf(elemType)
 
-			e.emit("mov rdx, rcx")
-			e.emit("add rdx, %d", len*elemSize)
-			e.emitLabel(br.beginLabel)
-			e.emit("cmp rcx, rdx")
-			e.emit("jge %s", br.falseLabel)
-			switch elemSize {
-			case 1:
-				e.emit("cmp al, byte ptr [rcx]")
-			case 8:
-				e.emit("cmp rax, qword ptr [rcx]")
-			}
-			e.emit("lea rcx, [rcx+%d]", elemSize)
-			e.emit("jne %s", br.beginLabel)
-			e.emit("mov rax, 1")
-			e.emit("jmp %s", br.endLabel)
-			e.emitLabel(br.falseLabel)
-			e.emit("mov rax, 0")
-			e.emitLabel(br.endLabel)
-		}
+	if isString(elemType) {
+		// the needle, the current and the end are kept on the stack while calling strcmp
+		e.emit("push rdx")
+		e.emit("push rcx")
+		e.emit("push rax")
+		e.emitLabel(br.beginLabel)
+		e.emit("mov rcx, qword ptr [rsp+8]")
+		e.emit("cmp rcx, qword ptr [rsp+16]")
+		e.emit("jge %s", br.falseLabel)
+		e.emit("add qword ptr [rsp+8], 8")
+		e.emit("mov rdi, qword ptr [rsp]")
+		e.emit("mov rsi, qword ptr [rcx]")
+		e.emitCall("strcmp")
+		e.emit("cmp eax, 0")
+		e.emit("jne %s", br.beginLabel)
+		e.emit("mov rax, 1")
+		e.emit("jmp %s", br.endLabel)
+		e.emitLabel(br.falseLabel)
+		e.emit("mov rax, 0")
+		e.emitLabel(br.endLabel)
+		e.emit("add rsp, 24")
+		return
+	}
+
+	if isFloat(elemType) {
+		e.emit("movq xmm0, rax")
+	}
+	e.emitLabel(br.beginLabel)
+	e.emit("cmp rcx, rdx")
+	e.emit("jge %s", br.falseLabel)
+	if isFloat(elemType) {
+		e.emit("ucomisd xmm0, qword ptr [rcx]")
+	} else {
+		e.emit("cmp %s, %s ptr [rcx]", raxParts[elemSize], ptrs[elemSize])
+	}
+	e.emit("lea rcx, [rcx+%d]", elemSize)
+	if isFloat(elemType) {
+		e.emit("jp %s", br.beginLabel) // NaN
+	}
+	e.emit("jne %s", br.beginLabel)
+	e.emit("mov rax, 1")
+	e.emit("jmp %s", br.endLabel)
+	e.emitLabel(br.falseLabel)
+	e.emit("mov rax, 0")
+	e.emitLabel(br.endLabel)
+}
+
+// emitStringOp operates on the strings in rax and rcx through the library functions.
+// The concatenation allocates the new string on the heap.
+func (e *emitter) emitStringOp(op token.Type) {
+	switch op {
+	case token.PLUS:
+		e.emit("push rcx")
+		e.emit("push rax")
+		e.emit("mov rdi, rax")
+		e.emitCall("strlen")
+		e.emit("push rax") // length of left
+		e.emit("mov rdi, qword ptr [rsp+16]")
+		e.emitCall("strlen")
+		e.emit("lea rdi, [rax+1]")
+		e.emit("add rdi, qword ptr [rsp]")
+		e.emitCall("malloc")
+		e.emit("mov rdi, rax")
+		e.emit("mov rsi, qword ptr [rsp+8]")
+		e.emitCall("strcpy")
+		e.emit("mov rdi, rax")
+		e.emit("mov rsi, qword ptr [rsp+16]")
+		e.emitCall("strcat")
+		e.emit("add rsp, 24")
+	case token.EQ, token.NE, token.LT, token.LE, token.GT, token.GE:
+		e.emit("mov rdi, rax")
+		e.emit("mov rsi, rcx")
+		e.emitCall("strcmp")
+		e.emit("cmp eax, 0")
+		e.emit("%s al", setcc[op])
+		e.emit("movzx rax, al")
+	}
+}
+
+// emitFloatOp operates on the floats in rax and rcx through xmm0 and xmm1.
+// The comparisons with NaN are false except !=.
+func (e *emitter) emitFloatOp(op token.Type) {
+	e.emit("movq xmm0, rax")
+	e.emit("movq xmm1, rcx")
+
+	switch op {
+	case token.PLUS:
+		e.emit("addsd xmm0, xmm1")
+	case token.MINUS:
+		e.emit("subsd xmm0, xmm1")
+	case token.ASTERISK:
+		e.emit("mulsd xmm0, xmm1")
+	case token.SLASH:
+		e.emit("divsd xmm0, xmm1")
+	case token.EQ:
+		e.emit("ucomisd xmm0, xmm1")
+		e.emit("sete al")
+		e.emit("setnp cl")
+		e.emit("and al, cl")
+	case token.NE:
+		e.emit("ucomisd xmm0, xmm1")
+		e.emit("setne al")
+		e.emit("setp cl")
+		e.emit("or al, cl")
+	case token.GT, token.GE:
+		e.emit("ucomisd xmm0, xmm1")
+		e.emit("%s al", floatSetcc[op])
+	case token.LT, token.LE:
+		// swap the operands, since below and equal are set for NaN
+		e.emit("ucomisd xmm1, xmm0")
+		e.emit("%s al", floatSetcc[op])
+	}
+
+	switch op {
+	case token.PLUS, token.MINUS, token.ASTERISK, token.SLASH:
+		e.emit("movq rax, xmm0")
+	default:
+		e.emit("movzx rax, al")
 	}
 }
 
 func (e *emitter) emitIndexExpr(expr *ast.IndexExpr) {
+	if isString(expr.Left.Type()) {
+		e.emitSubstring(expr)
+		return
+	}
+
 	e.emitExpr(expr.Index)
 	e.emit("push rax")
 	e.emitExpr(expr.Left)
+	if isSlice(expr.Left.Type()) {
+		e.emit("mov rax, qword ptr [rax]")
+	}
 	e.emit("pop rcx")
+	e.emitLoad(expr.Type(), e.elemAddr(expr.Type()))
+}
 
-	switch sizeOf(expr.Type()) {
-	case 1:
-		e.emit("movzx rax, byte ptr [rax+rcx]")
-	case 8:
-		e.emit("mov rax, qword ptr [rax+rcx*8]")
+// emitSubstring copies the bytes in the range to the new string on the heap.
+// The range is clipped to the bounds of the string, and gives the empty string if reversed.
+func (e *emitter) emitSubstring(expr *ast.IndexExpr) {
+	e.emitExpr(expr.Index) // rax: address of range
+	e.emit("push qword ptr [rax+8]")
+	e.emit("push qword ptr [rax]")
+	e.emitExpr(expr.Left)
+	e.emit("push rax")
+	e.emit("mov rdi, rax")
+	e.emitCall("strlen")
+
+	// clip the lower limit into 0..len, and the upper limit into lower..len
+	e.emit("mov rcx, qword ptr [rsp+8]")
+	e.emit("mov rdx, 0")
+	e.emit("cmp rcx, 0")
+	e.emit("cmovl rcx, rdx")
+	e.emit("cmp rcx, rax")
+	e.emit("cmovg rcx, rax")
+	e.emit("mov rsi, qword ptr [rsp+16]")
+	e.emit("cmp rsi, rcx")
+	e.emit("cmovl rsi, rcx")
+	e.emit("cmp rsi, rax")
+	e.emit("cmovg rsi, rax")
+	e.emit("sub rsi, rcx")
+	e.emit("add qword ptr [rsp], rcx") // beginning of the bytes
+	e.emit("mov qword ptr [rsp+8], rsi")
+
+	e.emit("lea rdi, [rsi+1]")
+	e.emitCall("malloc")
+	e.emit("mov rdx, qword ptr [rsp+8]")
+	e.emit("mov byte ptr [rax+rdx], 0")
+	e.emit("mov rdi, rax")
+	e.emit("mov rsi, qword ptr [rsp]")
+	e.emitCall("memcpy")
+	e.emit("add rsp, 24")
+}
+
+func (e *emitter) emitFieldExpr(expr *ast.FieldExpr) {
+	if enum, _ := ast.EnumVariant(expr); enum != nil {
+		e.emitVariant(expr, expr, nil)
+		return
 	}
+
+	e.emitExpr(expr.Left) // rax: address of struct
+	offset := offsetOf(types.Underlying(expr.Left.Type()).(*types.Struct), expr.Name)
+	e.emitLoad(expr.Type(), fmt.Sprintf("[rax+%d]", offset))
 }
 
 func (e *emitter) emitCallExpr(expr *ast.CallExpr) {
+	if enum, _ := ast.EnumVariant(expr.Left); enum != nil {
+		e.emitVariant(expr, expr.Left.(*ast.FieldExpr), expr.Params)
+		return
+	}
+	// the conversion does not change the representation except between int and float
+	if typ := ast.ConvType(expr); typ != nil {
+		e.emitExpr(expr.Params[0])
+		switch from := expr.Params[0].Type(); {
+		case isSlice(typ) && !isSlice(from):
+			e.emitSliceCopy(from)
+		case isChar(typ) && !isChar(from):
+			// the negative values, the surrogates and the values beyond U+10FFFF give U+FFFD
+			e.emit("mov ecx, 0xfffd")
+			e.emit("cmp rax, 0x10ffff")
+			e.emit("cmova rax, rcx")
+			e.emit("mov rdx, rax")
+			e.emit("and rdx, -0x800")
+			e.emit("cmp rdx, 0xd800")
+			e.emit("cmove rax, rcx")
+		case isFloat(typ) && isUint64(from):
+			// the value with the highest bit set is halved keeping the lowest bit for rounding, and doubled
+			e.emit("mov rcx, rax")
+			e.emit("shr rcx, 1")
+			e.emit("mov rdx, rax")
+			e.emit("and rdx, 1")
+			e.emit("or rcx, rdx")
+			e.emit("cvtsi2sd xmm1, rcx")
+			e.emit("addsd xmm1, xmm1")
+			e.emit("movq rcx, xmm1")
+			e.emit("cvtsi2sd xmm0, rax")
+			e.emit("test rax, rax")
+			e.emit("movq rax, xmm0")
+			e.emit("cmovs rax, rcx")
+		case isFloat(typ) && !isFloat(from):
+			e.emit("cvtsi2sd xmm0, rax")
+			e.emit("movq rax, xmm0")
+		case isUint64(typ) && isFloat(from):
+			// the value not less than 2^63 is converted after subtracting 2^63, which is added back to the bits
+			e.emit("movq xmm0, rax")
+			e.emit("mov rcx, %d", math.Float64bits(1<<63))
+			e.emit("movq xmm1, rcx")
+			e.emit("movsd xmm2, xmm0")
+			e.emit("subsd xmm2, xmm1")
+			e.emit("cvttsd2si rcx, xmm2")
+			e.emit("btc rcx, 63")
+			e.emit("cvttsd2si rax, xmm0")
+			e.emit("ucomisd xmm0, xmm1")
+			e.emit("cmovae rax, rcx")
+		case !isFloat(typ) && isFloat(from):
+			e.emit("movq xmm0, rax")
+			e.emit("cvttsd2si rax, xmm0")
+		}
+		e.emitExtend(typ)
+		return
+	}
+
 	for _, param := range expr.Params {
 		e.emitExpr(param)
 		e.emit("push rax")
 	}
-	for i := range expr.Params {
-		j := len(expr.Params) - 1 - i // reverse order
-		e.emit("pop %s", paramRegs[8][j])
+
+	// the hidden pointer to the storage for the returned value comes first
+	shift := 0
+	if !inRegs(expr.Type()) {
+		if lrec, ok := e.lrecs[expr]; ok {
+			e.emit("lea rdi, [rbp-%d]", lrec.offset)
+			shift = 1
+		} else if grec, ok := e.grecs[expr]; ok {
+			e.emit("mov rdi, offset flat:%s", grec.label)
+			shift = 1
+		}
+	}
+
+	_, stack := e.emitPopParams(expr.Params, shift)
+	if expr.Ref != nil {
+		fn := e.fns[expr.Ref]
+		e.emit("call %s", fn.label)
+	} else if e.isFuncDecl(expr.Left) {
+		fn := e.fns[expr.Left.(*ast.Ident).Ref]
+		e.emit("call %s", fn.label)
+	} else {
+		e.emitExpr(expr.Left)
+		e.emit("call rax")
 	}
-	if v, ok := expr.Left.(*ast.Ident); ok {
-		if v, ok := v.Ref.(*ast.FuncDecl); ok {
-			fn := e.fns[v]
-			e.emit("call %s", fn.label)
-			return
+	e.emitDropParams(expr.Params, stack)
+
+	// store the tuple returned in rax, rdx, xmm0 and xmm1
+	if inRegs(expr.Type()) {
+		typ := types.Underlying(expr.Type()).(*types.Tuple)
+		offsets := offsetsOf(typ)
+		regs := retRegs(typ.ElemTypes)
+
+		// the element returned in rax is stored first
+		order := []int{0, 1}
+		if regs[1] == "rax" {
+			order = []int{1, 0}
 		}
+		if lrec, ok := e.lrecs[expr]; ok {
+			for _, i := range order {
+				e.emitMove("rax", regs[i])
+				e.emitStore(typ.ElemTypes[i], fmt.Sprintf("[rbp-%d]", lrec.offset-offsets[i]))
+			}
+			e.emit("lea rax, [rbp-%d]", lrec.offset)
+		} else if grec, ok := e.grecs[expr]; ok {
+			for _, i := range order {
+				e.emitMove("rax", regs[i])
+				e.emitStore(typ.ElemTypes[i], fmt.Sprintf("%s[rip+%d]", grec.label, offsets[i]))
+			}
+			e.emit("mov rax, offset flat:%s", grec.label)
+		}
+	} else if isFloat(expr.Type()) {
+		e.emitMove("rax", "xmm0")
+	}
+}
+
+// emitPopParams pops the parameters pushed in order into the registers,
+// where the floats go to xmm registers. It returns the number of xmm registers used,
+// and the number of parameters on the stack.
+//
+// If the registers run out, the parameters are moved instead of popped, and the rest are copied
+// in order to the stack aligned to 16 bytes, above which the original stack pointer is saved.
+// The stack is restored by emitDropParams after the call.
+func (e *emitter) emitPopParams(params []ast.Expr, shift int) (int, int) {
+	var typs []types.Type
+	for _, param := range params {
+		typs = append(typs, param.Type())
+	}
+	indexes := paramIndexes(typs, shift)
+
+	stack := 0
+	for _, index := range indexes {
+		if index < 0 {
+			stack++
+		}
+	}
+
+	n := 0
+	if stack > 0 {
+		e.emit("mov r11, rsp") // r11: parameters pushed in order
+		e.emit("lea rsp, [rsp-%d]", (stack+1)*8)
+		e.emit("and rsp, -16")
+		e.emit("mov qword ptr [rsp+%d], r11", stack*8)
+
+		k := 0
+		for j := range params {
+			addr := fmt.Sprintf("[r11+%d]", (len(params)-1-j)*8)
+			switch {
+			case indexes[j] < 0:
+				e.emit("mov r10, qword ptr %s", addr)
+				e.emit("mov qword ptr [rsp+%d], r10", k*8)
+				k++
+			case isFloat(typs[j]):
+				e.emit("movq %s, qword ptr %s", xmmRegs[indexes[j]], addr)
+				n++
+			default:
+				e.emit("mov %s, qword ptr %s", paramRegs[8][indexes[j]], addr)
+			}
+		}
+		return n, stack
+	}
+
+	for i := range params {
+		j := len(params) - 1 - i // reverse order
+		if isFloat(typs[j]) {
+			e.emit("pop rax")
+			e.emitMove(xmmRegs[indexes[j]], "rax")
+			n++
+		} else {
+			e.emit("pop %s", paramRegs[8][indexes[j]])
+		}
+	}
+	return n, 0
+}
+
+// emitDropParams restores the stack after the call with the parameters on the stack.
+func (e *emitter) emitDropParams(params []ast.Expr, stack int) {
+	if stack == 0 {
+		return
+	}
+	e.emit("mov rsp, qword ptr [rsp+%d]", stack*8)
+	e.emit("add rsp, %d", len(params)*8)
+}
+
+// isFuncDecl checks if the expression refers to a function declaration.
+func (e *emitter) isFuncDecl(expr ast.Expr) bool {
+	if v, ok := expr.(*ast.Ident); ok {
+		_, ok := v.Ref.(*ast.FuncDecl)
+		return ok
+	}
+	return false
+}
+
+// emitVariant makes the enum of the variant with the payload in the storage for the expression.
+func (e *emitter) emitVariant(expr ast.Expr, variant *ast.FieldExpr, params []ast.Expr) {
+	enum, tag := ast.EnumVariant(variant)
+	payload := enum.Variants[tag].Payload
+	offsets := payloadOffsets(payload)
+
+	if lrec, ok := e.lrecs[expr]; ok {
+		for i, param := range params {
+			e.emitExpr(param)
+			e.emitStore(payload[i], fmt.Sprintf("[rbp-%d]", lrec.offset-offsets[i]))
+		}
+		e.emit("mov qword ptr [rbp-%d], %d", lrec.offset, tag)
+		e.emit("lea rax, [rbp-%d]", lrec.offset)
+	} else if grec, ok := e.grecs[expr]; ok {
+		for i, param := range params {
+			e.emitExpr(param)
+			e.emitStore(payload[i], fmt.Sprintf("%s[rip+%d]", grec.label, offsets[i]))
+		}
+		e.emit("mov qword ptr %s[rip], %d", grec.label, tag)
+		e.emit("mov rax, offset flat:%s", grec.label)
 	}
-	e.emitExpr(expr.Left)
-	e.emit("call rax")
 }
 
 func (e *emitter) emitLibCallExpr(expr *ast.LibCallExpr) {
+	if expr.Name == "format" {
+		e.emitFormatCall(expr)
+		return
+	}
+	if expr.Name == "append" {
+		e.emitAppend(expr)
+		return
+	}
+	if expr.Name == "len" || expr.Name == "cap" {
+		e.emitExpr(expr.Params[0])
+		switch v := types.Underlying(expr.Params[0].Type()).(type) {
+		case *types.String:
+			e.emit("mov rdi, rax")
+			e.emitCall("strlen")
+		case *types.Array:
+			e.emit("mov rax, %d", v.Len)
+		case *types.Slice:
+			if expr.Name == "len" {
+				e.emit("mov rax, qword ptr [rax+8]")
+			} else {
+				e.emit("mov rax, qword ptr [rax+16]")
+			}
+		}
+		return
+	}
+
 	for _, param := range expr.Params {
 		e.emitExpr(param)
 		e.emit("push rax")
 	}
-	for i := range expr.Params {
-		j := len(expr.Params) - 1 - i // reverse order
-		e.emit("pop %s", paramRegs[8][j])
+	n, stack := e.emitPopParams(expr.Params, 0)
+	e.emit("mov al, %d", n) // number of xmm registers for variadic function
+	if stack > 0 {
+		e.emit("call %s", expr.Name) // aligned already
+	} else {
+		e.emitCall(expr.Name)
 	}
-	e.emit("call %s", expr.Name)
+	e.emitDropParams(expr.Params, stack)
 }
 
-func (e *emitter) emitIdent(expr *ast.Ident) {
-	switch v := expr.Ref.(type) {
-	case *ast.VarDecl:
-		if lvar, ok := e.lvars[v]; ok {
-			switch lvar.size {
-			case 1:
-				e.emit("movzx rax, byte ptr [rbp-%d]", lvar.offset)
-			case 8:
-				e.emit("mov rax, qword ptr [rbp-%d]", lvar.offset)
+// emitAppend adds the elements to the end of the slice, whose header has the pointer to the elements,
+// the length and the capacity. The elements are moved to the larger storage when the capacity is exceeded.
+func (e *emitter) emitAppend(expr *ast.LibCallExpr) {
+	br := e.brs[expr]
+	elemType := types.Underlying(expr.Params[0].Type()).(*types.Slice).ElemType
+	elemSize := sizeOf(elemType)
+	n := len(expr.Params) - 1
+
+	// the header and the elements are kept on the stack while growing the slice.
+	// The structs, tuples, enums and tagged options are copied there,
+	// since they may refer to the storage of the slice freed by realloc.
+	e.emitExpr(expr.Params[0])
+	e.emit("push rax")
+	offsets := make([]int, n) // offset of each element from the top of the stack
+	total := 0
+	for i, param := range expr.Params[1:] {
+		e.emitExpr(param)
+		if inMemory(elemType) {
+			size := align(elemSize, 8)
+			e.emit("sub rsp, %d", size)
+			e.emitStore(elemType, "[rsp]")
+			offsets[i] = -total - size
+			total += size
+		} else {
+			e.emit("push rax")
+			offsets[i] = -total - 8
+			total += 8
+		}
+	}
+	for i := range offsets {
+		offsets[i] += total
+	}
+
+	// grow to the larger of the doubled capacity and the required length, and at least 4
+	e.emit("mov rax, qword ptr [rsp+%d]", total)
+	e.emit("mov rdx, qword ptr [rax+8]")
+	e.emit("add rdx, %d", n)
+	e.emit("mov rcx, qword ptr [rax+16]")
+	e.emit("cmp rdx, rcx")
+	e.emit("jle %s", br.endLabel)
+	e.emit("lea rsi, [rcx+rcx]")
+	e.emit("cmp rsi, rdx")
+	e.emit("cmovl rsi, rdx")
+	e.emit("mov rcx, 4")
+	e.emit("cmp rsi, rcx")
+	e.emit("cmovl rsi, rcx")
+	e.emit("mov qword ptr [rax+16], rsi")
+	e.emit("imul rsi, rsi, %d", elemSize)
+	e.emit("mov rdi, qword ptr [rax]")
+	e.emitCall("realloc")
+	e.emit("mov rcx, qword ptr [rsp+%d]", total)
+	e.emit("mov qword ptr [rcx], rax")
+	e.emitLabel(br.endLabel)
+
+	for i := 0; i < n; i++ {
+		e.emit("mov rcx, qword ptr [rsp+%d]", total)
+		e.emit("mov rdx, qword ptr [rcx+8]")
+		e.emit("inc qword ptr [rcx+8]")
+		e.emit("imul rdx, rdx, %d", elemSize)
+		e.emit("add rdx, qword ptr [rcx]") // rdx: address of the new element
+		if inMemory(elemType) {
+			e.emit("lea rax, [rsp+%d]", offsets[i])
+		} else {
+			e.emit("mov rax, qword ptr [rsp+%d]", offsets[i])
+		}
+		e.emitStore(elemType, "[rdx]")
+	}
+	e.emit("add rsp, %d", total+8)
+}
+
+// emitFormatCall writes the parameters as text to the stream on the memory,
+// which gives the new string on the heap after closed.
+func (e *emitter) emitFormatCall(expr *ast.LibCallExpr) {
+	e.emit("sub rsp, 16") // pointer to the string and its size, set by open_memstream
+	e.emit("lea rdi, [rsp]")
+	e.emit("lea rsi, [rsp+8]")
+	e.emitCall("open_memstream")
+	e.emit("push rax") // stream
+
+	for _, param := range expr.Params {
+		e.emitExpr(param)
+		e.emitFormat(param.Type(), 0, e.fmts[param].brs)
+	}
+
+	e.emit("mov rdi, qword ptr [rsp]")
+	e.emitCall("fclose")
+	e.emit("mov rax, qword ptr [rsp+8]")
+	e.emit("add rsp, 24")
+}
+
+// emitFormat writes the value of the type in rax as text to the stream at [rsp+offset].
+// The arrays and slices are written with their elements, looping with the labels in brs.
+func (e *emitter) emitFormat(typ types.Type, offset int, brs []*br) {
+	switch v := types.Underlying(typ).(type) {
+	case *types.Int:
+		e.emit("mov rdx, rax")
+		e.emit("mov rdi, qword ptr [rsp+%d]", offset)
+		if v.Unsigned {
+			e.emit("mov rsi, offset flat:fmtuint")
+		} else {
+			e.emit("mov rsi, offset flat:fmtint")
+		}
+		e.emit("mov al, 0")
+		e.emitCall("fprintf")
+	case *types.Float:
+		e.emit("movq xmm0, rax")
+		e.emit("mov rdi, qword ptr [rsp+%d]", offset)
+		e.emit("mov rsi, offset flat:fmtfloat")
+		e.emit("mov al, 1")
+		e.emitCall("fprintf")
+	case *types.Char:
+		e.emit("mov edi, eax")
+		e.emit("mov rsi, qword ptr [rsp+%d]", offset)
+		e.emitCall("fmtchar")
+	case *types.Bool:
+		e.emit("mov rdi, offset flat:fmttrue")
+		e.emit("mov rcx, offset flat:fmtfalse")
+		e.emit("cmp rax, 0")
+		e.emit("cmove rdi, rcx")
+		e.emit("mov rsi, qword ptr [rsp+%d]", offset)
+		e.emitCall("fputs")
+	case *types.String:
+		e.emit("mov rdi, rax")
+		e.emit("mov rsi, qword ptr [rsp+%d]", offset)
+		e.emitCall("fputs")
+	case *types.Range:
+		e.emit("mov rdx, qword ptr [rax]")
+		e.emit("mov rcx, qword ptr [rax+8]")
+		e.emit("mov rdi, qword ptr [rsp+%d]", offset)
+		e.emit("mov rsi, offset flat:fmtrange")
+		e.emit("mov al, 0")
+		e.emitCall("fprintf")
+	case *types.Array:
+		e.emit("lea rcx, [rax+%d]", v.Len*sizeOf(v.ElemType))
+		e.emitFormatElems(v.ElemType, offset, brs)
+	case *types.Slice:
+		e.emit("mov rcx, qword ptr [rax+8]")
+		e.emit("imul rcx, rcx, %d", sizeOf(v.ElemType))
+		e.emit("mov rax, qword ptr [rax]")
+		e.emit("add rcx, rax")
+		e.emitFormatElems(v.ElemType, offset, brs)
+	}
+}
+
+// emitFormatElems writes the elements from rax to rcx in brackets, separated by commas.
+func (e *emitter) emitFormatElems(elemType types.Type, offset int, brs []*br) {
+	br := brs[0]
+	elemSize := sizeOf(elemType)
+
+	e.emit("push rcx") // end
+	e.emit("push rax") // current element
+	e.emit("mov edi, %d", '[')
+	e.emit("mov rsi, qword ptr [rsp+%d]", offset+16)
+	e.emitCall("fputc")
+
+	e.emitLabel(br.beginLabel)
+	e.emit("mov rax, qword ptr [rsp]")
+	e.emit("cmp rax, qword ptr [rsp+8]")
+	e.emit("jae %s", br.endLabel)
+	e.emit("add qword ptr [rsp], %d", elemSize)
+	e.emitLoad(elemType, "[rax]")
+	e.emitFormat(elemType, offset+16, brs[1:])
+	e.emit("mov rax, qword ptr [rsp]")
+	e.emit("cmp rax, qword ptr [rsp+8]")
+	e.emit("jae %s", br.endLabel)
+	e.emit("mov rdi, offset flat:fmtsep")
+	e.emit("mov rsi, qword ptr [rsp+%d]", offset+16)
+	e.emitCall("fputs")
+	e.emit("jmp %s", br.beginLabel)
+	e.emitLabel(br.endLabel)
+
+	e.emit("add rsp, 16")
+	e.emit("mov edi, %d", ']')
+	e.emit("mov rsi, qword ptr [rsp+%d]", offset)
+	e.emitCall("fputc")
+}
+
+// emitFmtChar emits the function to write the character in edi to the stream in rsi,
+// encoding it into UTF-8 of 1 to 4 bytes on the stack.
+func (e *emitter) emitFmtChar() {
+	e.emitLabel("fmtchar")
+	e.emit("sub rsp, 24")
+	e.emit("mov qword ptr [rsp], 0")
+	for n := 1; n <= 4; n++ {
+		if n > 1 {
+			e.emitLabel(fmt.Sprintf("fmtchar%d", n))
+		}
+		if n < 4 {
+			e.emit("cmp edi, %d", []int{0x80, 0x800, 0x10000}[n-1])
+			e.emit("jae fmtchar%d", n+1)
+		}
+		for i := 0; i < n; i++ {
+			e.emit("mov eax, edi")
+			if shift := 6 * (n - 1 - i); shift > 0 {
+				e.emit("shr eax, %d", shift)
 			}
-		} else if gvar, ok := e.gvars[v]; ok {
-			switch gvar.size {
-			case 1:
-				e.emit("movzx rax, byte ptr %s[rip]", gvar.label)
-			case 8:
-				e.emit("mov rax, qword ptr %s[rip]", gvar.label)
+			switch {
+			case n == 1:
+				// ASCII
+			case i == 0:
+				e.emit("or al, %d", 0xF00>>n&0xFF) // leading byte with n bits set
+			default:
+				e.emit("and al, 0x3F")
+				e.emit("or al, 0x80")
 			}
+			e.emit("mov byte ptr [rsp+%d], al", i)
 		}
+		e.emit("jmp fmtcharput")
+	}
+	e.emitLabel("fmtcharput")
+	e.emit("mov rdi, rsp")
+	e.emit("call fputs")
+	e.emit("add rsp, 24")
+	e.emit("ret")
+}
+
+// emitCall calls the library function, whose parameters are already in the registers.
+func (e *emitter) emitCall(name string) {
+	// align the stack to 16 bytes, saving the original pointer twice
+	e.emit("push rsp")
+	e.emit("push qword ptr [rsp]")
+	e.emit("and rsp, -16")
+	e.emit("call %s", name)
+	e.emit("mov rsp, qword ptr [rsp+8]")
+}
+
+func (e *emitter) emitIdent(expr *ast.Ident) {
+	switch v := expr.Ref.(type) {
+	case *ast.VarDecl:
+		e.emitLoad(v.VarType, e.varAddr(v))
 	case *ast.FuncDecl:
 		fn := e.fns[v]
 		e.emit("mov rax, offset flat:%s", fn.label)
 	}
 }
 
+func (e *emitter) emitStructLit(expr *ast.StructLit) {
+	s := expr.Type().(*types.Struct)
+
+	if lrec, ok := e.lrecs[expr]; ok {
+		for _, field := range expr.Fields {
+			e.emitExpr(field.Value)
+			offset := lrec.offset - offsetOf(s, field.Name)
+			e.emitStore(field.VarType, fmt.Sprintf("[rbp-%d]", offset))
+		}
+		e.emit("lea rax, [rbp-%d]", lrec.offset)
+	} else if grec, ok := e.grecs[expr]; ok {
+		for _, field := range expr.Fields {
+			e.emitExpr(field.Value)
+			offset := offsetOf(s, field.Name)
+			e.emitStore(field.VarType, fmt.Sprintf("%s[rip+%d]", grec.label, offset))
+		}
+		e.emit("mov rax, offset flat:%s", grec.label)
+	}
+}
+
 func (e *emitter) emitIntLit(expr *ast.IntLit) {
 	e.emit("mov rax, %d", expr.Value)
 }
 
+func (e *emitter) emitFloatLit(expr *ast.FloatLit) {
+	e.emit("mov rax, %d", int64(math.Float64bits(expr.Value)))
+}
+
+func (e *emitter) emitCharLit(expr *ast.CharLit) {
+	e.emit("mov rax, %d", expr.Value)
+}
+
 func (e *emitter) emitBoolLit(expr *ast.BoolLit) {
 	if expr.Value {
 		e.emit("mov rax, 1")
@@ -643,6 +1873,38 @@ func (e *emitter) emitBoolLit(expr *ast.BoolLit) {
 	}
 }
 
+func (e *emitter) emitNoneLit(expr *ast.NoneLit) {
+	if lrec, ok := e.lrecs[expr]; ok {
+		e.emit("mov byte ptr [rbp-%d], 0", lrec.offset)
+		e.emit("lea rax, [rbp-%d]", lrec.offset)
+	} else if grec, ok := e.grecs[expr]; ok {
+		e.emit("mov byte ptr %s[rip], 0", grec.label)
+		e.emit("mov rax, offset flat:%s", grec.label)
+	} else {
+		e.emit("mov rax, 0")
+	}
+}
+
+func (e *emitter) emitSomeExpr(expr *ast.SomeExpr) {
+	e.emitExpr(expr.Value)
+
+	// the value itself is the option represented by pointer
+	if !inMemory(expr.Type()) {
+		return
+	}
+	offset := offsetsOf(expr.Type())[1]
+
+	if lrec, ok := e.lrecs[expr]; ok {
+		e.emitStore(expr.Value.Type(), fmt.Sprintf("[rbp-%d]", lrec.offset-offset))
+		e.emit("mov byte ptr [rbp-%d], 1", lrec.offset)
+		e.emit("lea rax, [rbp-%d]", lrec.offset)
+	} else if grec, ok := e.grecs[expr]; ok {
+		e.emitStore(expr.Value.Type(), fmt.Sprintf("%s[rip+%d]", grec.label, offset))
+		e.emit("mov byte ptr %s[rip], 1", grec.label)
+		e.emit("mov rax, offset flat:%s", grec.label)
+	}
+}
+
 func (e *emitter) emitStringLit(expr *ast.StringLit) {
 	str := e.strs[expr]
 	e.emit("mov rax, offset flat:%s", str.label)
@@ -665,55 +1927,53 @@ func (e *emitter) emitRangeLit(expr *ast.RangeLit) {
 }
 
 func (e *emitter) emitArrayLit(expr *ast.ArrayLit) {
+	elemType := expr.Type().(*types.Array).ElemType
+
 	if larr, ok := e.larrs[expr]; ok {
 		for i, elem := range expr.Elems {
 			e.emitExpr(elem)
 			offset := larr.offset - i*larr.elemSize
-			switch larr.elemSize {
-			case 1:
-				e.emit("mov byte ptr [rbp-%d], al", offset)
-			case 8:
-				e.emit("mov qword ptr [rbp-%d], rax", offset)
-			}
+			e.emitStore(elemType, fmt.Sprintf("[rbp-%d]", offset))
 		}
 		e.emit("lea rax, [rbp-%d]", larr.offset)
 	} else if garr, ok := e.garrs[expr]; ok {
 		for i, elem := range expr.Elems {
 			e.emitExpr(elem)
 			offset := i * garr.elemSize
-			switch garr.elemSize {
-			case 1:
-				e.emit("mov byte ptr %s[rip+%d], al", garr.label, offset)
-			case 8:
-				e.emit("mov qword ptr %s[rip+%d], rax", garr.label, offset)
-			}
+			e.emitStore(elemType, fmt.Sprintf("%s[rip+%d]", garr.label, offset))
 		}
 		e.emit("mov rax, offset flat:%s", garr.label)
 	}
 }
 
 func (e *emitter) emitArrayShortLit(expr *ast.ArrayShortLit) {
-	if expr.Value != nil {
+	if inMemory(expr.ElemType) && expr.Value != nil && expr.Len > 0 {
+		e.emitExpr(expr.Value)
+
+		if larr, ok := e.larrs[expr]; ok {
+			e.emitStore(expr.ElemType, fmt.Sprintf("[rbp-%d]", larr.offset))
+			e.emit("lea rsi, [rbp-%d]", larr.offset)
+		} else if garr, ok := e.garrs[expr]; ok {
+			e.emitStore(expr.ElemType, garr.label+"[rip]")
+			e.emit("mov rsi, offset flat:%s", garr.label)
+		}
+		// copying forward byte by byte from the first element to the second
+		// repeats the first element up to the last
+		size := sizeOf(expr.ElemType)
+		e.emit("lea rdi, [rsi+%d]", size)
+		e.emit("mov rcx, %d", (expr.Len-1)*size)
+		e.emit("rep movsb")
+	} else if expr.Value != nil {
 		e.emitExpr(expr.Value)
 
 		if larr, ok := e.larrs[expr]; ok {
 			e.emit("lea rdi, [rbp-%d]", larr.offset)
 			e.emit("mov rcx, %d", larr.len)
-			switch larr.elemSize {
-			case 1:
-				e.emit("rep stosb")
-			case 8:
-				e.emit("rep stosq")
-			}
+			e.emit("rep %s", stos[larr.elemSize])
 		} else if garr, ok := e.garrs[expr]; ok {
 			e.emit("mov rdi, offset flat:%s", garr.label)
 			e.emit("mov rcx, %d", garr.len)
-			switch garr.elemSize {
-			case 1:
-				e.emit("rep stosb")
-			case 8:
-				e.emit("rep stosq")
-			}
+			e.emit("rep %s", stos[garr.elemSize])
 		}
 	}
 
@@ -724,6 +1984,75 @@ func (e *emitter) emitArrayShortLit(expr *ast.ArrayShortLit) {
 	}
 }
 
+func (e *emitter) emitSliceLit(expr *ast.SliceLit) {
+	if expr.Value != nil {
+		e.emitExpr(expr.Value)
+		e.emitSliceCopy(expr.Value.Type())
+		return
+	}
+
+	// the empty slice has no storage for the elements until appended
+	e.emit("mov rdi, 24")
+	e.emitCall("malloc")
+	e.emit("mov qword ptr [rax], 0")
+	e.emit("mov qword ptr [rax+8], 0")
+	e.emit("mov qword ptr [rax+16], 0")
+}
+
+// emitSliceCopy copies the elements of the array or slice in rax to the new slice on the heap.
+func (e *emitter) emitSliceCopy(from types.Type) {
+	var elemType types.Type
+	switch v := types.Underlying(from).(type) {
+	case *types.Array:
+		elemType = v.ElemType
+		e.emit("mov rcx, %d", v.Len)
+		e.emit("push rcx")
+		e.emit("push rax")
+	case *types.Slice:
+		elemType = v.ElemType
+		e.emit("push qword ptr [rax+8]")
+		e.emit("push qword ptr [rax]")
+	}
+	size := sizeOf(elemType)
+
+	// the header, the source elements and the length are kept on the stack
+	e.emit("mov rdi, 24")
+	e.emitCall("malloc")
+	e.emit("push rax")
+	e.emit("mov rcx, qword ptr [rsp+16]")
+	e.emit("mov qword ptr [rax+8], rcx")
+	e.emit("mov qword ptr [rax+16], rcx")
+	e.emit("imul rdi, rcx, %d", size)
+	e.emitCall("malloc")
+	e.emit("mov rcx, qword ptr [rsp]")
+	e.emit("mov qword ptr [rcx], rax")
+	e.emit("mov rdi, rax")
+	e.emit("mov rsi, qword ptr [rsp+8]")
+	e.emit("imul rdx, qword ptr [rsp+16], %d", size)
+	e.emitCall("memcpy")
+	e.emit("pop rax")
+	e.emit("add rsp, 16")
+}
+
+func (e *emitter) emitTupleLit(expr *ast.TupleLit) {
+	typ := expr.Type().(*types.Tuple)
+	offsets := offsetsOf(typ)
+
+	if lrec, ok := e.lrecs[expr]; ok {
+		for i, elem := range expr.Elems {
+			e.emitExpr(elem)
+			e.emitStore(typ.ElemTypes[i], fmt.Sprintf("[rbp-%d]", lrec.offset-offsets[i]))
+		}
+		e.emit("lea rax, [rbp-%d]", lrec.offset)
+	} else if grec, ok := e.grecs[expr]; ok {
+		for i, elem := range expr.Elems {
+			e.emitExpr(elem)
+			e.emitStore(typ.ElemTypes[i], fmt.Sprintf("%s[rip+%d]", grec.label, offsets[i]))
+		}
+		e.emit("mov rax, offset flat:%s", grec.label)
+	}
+}
+
 func (e *emitter) emitFuncLit(expr *ast.FuncLit) {
 	fn := e.fns[expr]
 	e.emit("mov rax, offset flat:%s", fn.label)
@@ -13,10 +13,13 @@ type explorer struct {
 	gvars map[ast.Decl]*gvar
 	grans map[ast.Expr]*gran
 	garrs map[ast.Expr]*garr
+	grecs map[ast.Expr]*grec
 	lvars map[ast.Decl]*lvar
 	lrans map[ast.Expr]*lran
 	larrs map[ast.Expr]*larr
+	lrecs map[ast.Expr]*lrec
 	strs  map[ast.Expr]*str
+	fmts  map[ast.Expr]*fmtv
 	fns   map[ast.Node]*fn
 	brs   map[ast.Node]*br
 
@@ -37,6 +40,10 @@ func (x *explorer) garrLabel() string {
 	return fmt.Sprintf("garr%d", len(x.garrs))
 }
 
+func (x *explorer) grecLabel() string {
+	return fmt.Sprintf("grec%d", len(x.grecs))
+}
+
 func (x *explorer) strLabel() string {
 	return fmt.Sprintf("str%d", len(x.strs))
 }
@@ -77,6 +84,8 @@ func (x *explorer) exploreStmt(stmt ast.Stmt) {
 		x.exploreWhileStmt(v)
 	case *ast.ForStmt:
 		x.exploreForStmt(v)
+	case *ast.MatchStmt:
+		x.exploreMatchStmt(v)
 	case *ast.ReturnStmt:
 		x.exploreReturnStmt(v)
 	case *ast.AssignStmt:
@@ -93,17 +102,31 @@ func (x *explorer) exploreBlockStmt(stmt *ast.BlockStmt) {
 }
 
 func (x *explorer) exploreVarStmt(stmt *ast.VarStmt) {
+	if stmt.Value != nil {
+		x.exploreExpr(stmt.Value)
+	}
 	for _, v := range stmt.Vars {
 		x.exploreVarDecl(v)
 	}
 }
 
 func (x *explorer) exploreFuncStmt(stmt *ast.FuncStmt) {
+	// generic function is compiled for each instance
+	if len(stmt.Func.TypeParams) > 0 {
+		for _, inst := range stmt.Func.Instances {
+			x.exploreFuncDecl(inst)
+		}
+		return
+	}
 	x.exploreFuncDecl(stmt.Func)
 }
 
 func (x *explorer) exploreIfStmt(stmt *ast.IfStmt) {
-	x.exploreExpr(stmt.Cond)
+	if stmt.Var != nil {
+		x.exploreVarDecl(stmt.Var)
+	} else {
+		x.exploreExpr(stmt.Cond)
+	}
 	x.exploreBlockStmt(stmt.Body)
 
 	if stmt.Else == nil {
@@ -127,12 +150,47 @@ func (x *explorer) exploreForStmt(stmt *ast.ForStmt) {
 	x.exploreVarDecl(stmt.Index)
 	x.exploreVarDecl(stmt.Iter)
 	beginLabel := x.brLabel()
+	var loopLabel, trimLabel, invalidLabel, doneLabel string
+	if _, ok := types.Underlying(stmt.Iter.VarType).(*types.String); ok {
+		loopLabel, trimLabel, invalidLabel, doneLabel = x.brLabel(), x.brLabel(), x.brLabel(), x.brLabel()
+	}
 	x.exploreBlockStmt(stmt.Body)
 	x.brs[stmt] = &br{
 		beginLabel:    beginLabel,
 		continueLabel: x.brLabel(),
 		endLabel:      x.brLabel(),
+		loopLabel:     loopLabel,
+		trimLabel:     trimLabel,
+		invalidLabel:  invalidLabel,
+		doneLabel:     doneLabel,
+	}
+}
+
+func (x *explorer) exploreMatchStmt(stmt *ast.MatchStmt) {
+	x.exploreExpr(stmt.Value)
+
+	var tableLabel string
+	if _, _, ok := jumpTable(stmt); ok {
+		tableLabel = x.brLabel()
+	}
+
+	for _, arm := range stmt.Arms {
+		for _, pat := range arm.Patterns {
+			switch v := pat.(type) {
+			case *ast.VariantPattern:
+				for _, binding := range v.Bindings {
+					if binding.Name != "_" {
+						x.exploreVarDecl(binding)
+					}
+				}
+			case *ast.StringLit:
+				x.exploreStringLit(v)
+			}
+		}
+		x.brs[arm] = &br{beginLabel: x.brLabel()}
+		x.exploreBlockStmt(arm.Body)
 	}
+	x.brs[stmt] = &br{tableLabel: tableLabel, endLabel: x.brLabel()}
 }
 
 func (x *explorer) exploreReturnStmt(stmt *ast.ReturnStmt) {
@@ -142,7 +200,14 @@ func (x *explorer) exploreReturnStmt(stmt *ast.ReturnStmt) {
 }
 
 func (x *explorer) exploreAssignStmt(stmt *ast.AssignStmt) {
-	x.exploreExpr(stmt.Target)
+	if v, ok := stmt.Target.(*ast.TupleLit); ok {
+		// the targets are not stored in a tuple
+		for _, target := range v.Elems {
+			x.exploreExpr(target)
+		}
+	} else {
+		x.exploreExpr(stmt.Target)
+	}
 	x.exploreExpr(stmt.Value)
 }
 
@@ -161,10 +226,18 @@ func (x *explorer) exploreExpr(expr ast.Expr) {
 		x.exploreInfixExpr(v)
 	case *ast.IndexExpr:
 		x.exploreIndexExpr(v)
+	case *ast.FieldExpr:
+		x.exploreFieldExpr(v)
 	case *ast.CallExpr:
 		x.exploreCallExpr(v)
 	case *ast.LibCallExpr:
 		x.exploreLibCallExpr(v)
+	case *ast.StructLit:
+		x.exploreStructLit(v)
+	case *ast.NoneLit:
+		x.exploreNoneLit(v)
+	case *ast.SomeExpr:
+		x.exploreSomeExpr(v)
 	case *ast.StringLit:
 		x.exploreStringLit(v)
 	case *ast.RangeLit:
@@ -173,6 +246,10 @@ func (x *explorer) exploreExpr(expr ast.Expr) {
 		x.exploreArrayLit(v)
 	case *ast.ArrayShortLit:
 		x.exploreArrayShortLit(v)
+	case *ast.SliceLit:
+		x.exploreSliceLit(v)
+	case *ast.TupleLit:
+		x.exploreTupleLit(v)
 	case *ast.FuncLit:
 		x.exploreFuncLit(v)
 	}
@@ -183,6 +260,11 @@ func (x *explorer) explorePrefixExpr(expr *ast.PrefixExpr) {
 }
 
 func (x *explorer) exploreInfixExpr(expr *ast.InfixExpr) {
+	if opt, ok := ast.NoneOperand(expr); ok {
+		x.exploreExpr(opt)
+		return
+	}
+
 	x.exploreExpr(expr.Left)
 	x.exploreExpr(expr.Right)
 
@@ -190,13 +272,13 @@ func (x *explorer) exploreInfixExpr(expr *ast.InfixExpr) {
 	case token.AND, token.OR:
 		x.brs[expr] = &br{endLabel: x.brLabel()}
 	case token.IN:
-		switch expr.Right.Type().(type) {
+		switch types.Underlying(expr.Right.Type()).(type) {
 		case *types.Range:
 			x.brs[expr] = &br{
 				falseLabel: x.brLabel(),
 				endLabel:   x.brLabel(),
 			}
-		case *types.Array:
+		case *types.Array, *types.Slice:
 			x.brs[expr] = &br{
 				beginLabel: x.brLabel(),
 				falseLabel: x.brLabel(),
@@ -211,16 +293,102 @@ func (x *explorer) exploreIndexExpr(expr *ast.IndexExpr) {
 	x.exploreExpr(expr.Index)
 }
 
-func (x *explorer) exploreCallExpr(expr *ast.CallExpr) {
+func (x *explorer) exploreFieldExpr(expr *ast.FieldExpr) {
+	// storage for the variant without payload
+	if enum, _ := ast.EnumVariant(expr); enum != nil {
+		x.exploreRec(expr)
+		return
+	}
 	x.exploreExpr(expr.Left)
+}
+
+func (x *explorer) exploreCallExpr(expr *ast.CallExpr) {
+	if typ := ast.ConvType(expr); typ != nil {
+		x.exploreExpr(expr.Params[0])
+		return
+	}
+	// the variant is not a value, but makes the enum with the parameters
+	if enum, _ := ast.EnumVariant(expr.Left); enum == nil {
+		x.exploreExpr(expr.Left)
+	}
 	for _, param := range expr.Params {
 		x.exploreExpr(param)
 	}
+
+	// storage for the returned struct, tuple or enum
+	if inMemory(expr.Type()) {
+		x.exploreRec(expr)
+	}
 }
 
 func (x *explorer) exploreLibCallExpr(expr *ast.LibCallExpr) {
 	for _, param := range expr.Params {
 		x.exploreExpr(param)
+		if expr.Name == "format" {
+			x.exploreFmt(param)
+		}
+	}
+	// label to skip growing the slice
+	if expr.Name == "append" {
+		x.brs[expr] = &br{endLabel: x.brLabel()}
+	}
+}
+
+// exploreFmt collects the labels to format the value, which loops over the nested arrays and slices if any.
+func (x *explorer) exploreFmt(expr ast.Expr) {
+	fmtv := new(fmtv)
+	x.fmts[expr] = fmtv
+
+	typ := expr.Type()
+	for {
+		switch v := types.Underlying(typ).(type) {
+		case *types.Array:
+			typ = v.ElemType
+		case *types.Slice:
+			typ = v.ElemType
+		default:
+			return
+		}
+		fmtv.brs = append(fmtv.brs, &br{
+			beginLabel: x.brLabel(),
+			endLabel:   x.brLabel(),
+		})
+	}
+}
+
+func (x *explorer) exploreStructLit(expr *ast.StructLit) {
+	for _, field := range expr.Fields {
+		x.exploreExpr(field.Value)
+	}
+	x.exploreRec(expr)
+}
+
+// exploreRec allocates the storage for the struct, tuple, enum or option value of the expression.
+func (x *explorer) exploreRec(expr ast.Expr) {
+	size := sizeOf(expr.Type())
+	boundary := alignOf(expr.Type())
+
+	if x.local {
+		x.offset = align(x.offset+size, boundary)
+		x.lrecs[expr] = &lrec{offset: x.offset}
+	} else {
+		x.grecs[expr] = &grec{label: x.grecLabel(), size: size, align: boundary}
+	}
+}
+
+func (x *explorer) exploreNoneLit(expr *ast.NoneLit) {
+	// storage for the option with tag
+	if inMemory(expr.Type()) {
+		x.exploreRec(expr)
+	}
+}
+
+func (x *explorer) exploreSomeExpr(expr *ast.SomeExpr) {
+	x.exploreExpr(expr.Value)
+
+	// storage for the option with tag
+	if inMemory(expr.Type()) {
+		x.exploreRec(expr)
 	}
 }
 
@@ -248,12 +416,13 @@ func (x *explorer) exploreArrayLit(expr *ast.ArrayLit) {
 	arr := expr.Type().(*types.Array)
 	len := arr.Len
 	elemSize := sizeOf(arr.ElemType)
+	elemAlign := alignOf(arr.ElemType)
 
 	if x.local {
-		x.offset = align(x.offset+len*elemSize, elemSize)
+		x.offset = align(x.offset+len*elemSize, elemAlign)
 		x.larrs[expr] = &larr{offset: x.offset, len: len, elemSize: elemSize}
 	} else {
-		x.garrs[expr] = &garr{label: x.garrLabel(), len: len, elemSize: elemSize}
+		x.garrs[expr] = &garr{label: x.garrLabel(), len: len, elemSize: elemSize, elemAlign: elemAlign}
 	}
 }
 
@@ -264,26 +433,46 @@ func (x *explorer) exploreArrayShortLit(expr *ast.ArrayShortLit) {
 
 	len := expr.Len
 	elemSize := sizeOf(expr.ElemType)
+	elemAlign := alignOf(expr.ElemType)
 
 	if x.local {
-		x.offset = align(x.offset+len*elemSize, elemSize)
+		x.offset = align(x.offset+len*elemSize, elemAlign)
 		x.larrs[expr] = &larr{offset: x.offset, len: len, elemSize: elemSize}
 	} else {
-		x.garrs[expr] = &garr{label: x.garrLabel(), len: len, elemSize: elemSize}
+		x.garrs[expr] = &garr{label: x.garrLabel(), len: len, elemSize: elemSize, elemAlign: elemAlign}
+	}
+}
+
+func (x *explorer) exploreSliceLit(expr *ast.SliceLit) {
+	// the elements are stored on the heap
+	if expr.Value != nil {
+		x.exploreExpr(expr.Value)
+	}
+}
+
+func (x *explorer) exploreTupleLit(expr *ast.TupleLit) {
+	for _, elem := range expr.Elems {
+		x.exploreExpr(elem)
 	}
+	x.exploreRec(expr)
 }
 
 func (x *explorer) exploreFuncLit(expr *ast.FuncLit) {
 	x.local = true
 	x.offset = 0
 
+	retOffset := x.exploreRet(expr.ReturnType)
 	for _, param := range expr.Params {
 		x.exploreVarDecl(param)
 	}
 	x.exploreBlockStmt(expr.Body)
 
 	x.local = false
-	x.fns[expr] = &fn{label: x.fnLabel(), localArea: align(x.offset, 16)}
+	x.fns[expr] = &fn{
+		label:     x.fnLabel(),
+		localArea: align(x.offset, 16),
+		retOffset: retOffset,
+	}
 	x.brs[expr] = &br{endLabel: x.brLabel()}
 }
 
@@ -297,12 +486,13 @@ func (x *explorer) exploreVarDecl(decl *ast.VarDecl) {
 
 	size := sizeOf(decl.VarType)
 	if x.local {
-		x.offset = align(x.offset+size, size)
+		x.offset = align(x.offset+size, alignOf(decl.VarType))
 		x.lvars[decl] = &lvar{offset: x.offset, size: size}
 	} else {
 		x.gvars[decl] = &gvar{
 			label: x.gvarLabel() + "_" + decl.Name,
 			size:  size,
+			align: alignOf(decl.VarType),
 		}
 	}
 }
@@ -311,6 +501,7 @@ func (x *explorer) exploreFuncDecl(decl *ast.FuncDecl) {
 	x.local = true
 	x.offset = 0
 
+	retOffset := x.exploreRet(decl.ReturnType)
 	for _, param := range decl.Params {
 		x.exploreVarDecl(param)
 	}
@@ -320,6 +511,18 @@ func (x *explorer) exploreFuncDecl(decl *ast.FuncDecl) {
 	x.fns[decl] = &fn{
 		label:     x.fnLabel() + "_" + decl.Name,
 		localArea: align(x.offset, 16),
+		retOffset: retOffset,
 	}
 	x.brs[decl] = &br{endLabel: x.brLabel()}
 }
+
+// exploreRet allocates the slot for the hidden pointer, given by the caller in rdi,
+// to the storage for the returned struct, tuple or enum. It returns 0 if the return value
+// is not given through the hidden pointer.
+func (x *explorer) exploreRet(typ types.Type) int {
+	if !inMemory(typ) || inRegs(typ) {
+		return 0
+	}
+	x.offset = align(x.offset+8, 8)
+	return x.offset
+}
@@ -1,32 +1,46 @@
 package gen
 
-import "github.com/oshima/lang/ast"
+import (
+	"bufio"
+	"io"
 
-// Generate emits the target assembly code.
-func Generate(prog *ast.Program) {
+	"github.com/oshima/lang/ast"
+)
+
+// Generate emits the target assembly code to w.
+func Generate(prog *ast.Program, w io.Writer) error {
 	x := &explorer{
 		gvars: make(map[ast.Decl]*gvar),
 		grans: make(map[ast.Expr]*gran),
 		garrs: make(map[ast.Expr]*garr),
+		grecs: make(map[ast.Expr]*grec),
 		lvars: make(map[ast.Decl]*lvar),
 		lrans: make(map[ast.Expr]*lran),
 		larrs: make(map[ast.Expr]*larr),
+		lrecs: make(map[ast.Expr]*lrec),
 		strs:  make(map[ast.Expr]*str),
+		fmts:  make(map[ast.Expr]*fmtv),
 		fns:   make(map[ast.Node]*fn),
 		brs:   make(map[ast.Node]*br),
 	}
 	x.exploreProgram(prog)
 
 	e := &emitter{
+		w:     bufio.NewWriter(w),
 		gvars: x.gvars,
 		grans: x.grans,
 		garrs: x.garrs,
+		grecs: x.grecs,
 		lvars: x.lvars,
 		lrans: x.lrans,
 		larrs: x.larrs,
+		lrecs: x.lrecs,
 		strs:  x.strs,
+		fmts:  x.fmts,
 		fns:   x.fns,
 		brs:   x.brs,
 	}
 	e.emitProgram(prog)
+
+	return e.w.Flush()
 }
@@ -4,6 +4,7 @@ package gen
 type gvar struct {
 	label string
 	size  int
+	align int
 }
 
 // global range
@@ -13,9 +14,17 @@ type gran struct {
 
 // global array
 type garr struct {
-	label    string
-	len      int
-	elemSize int
+	label     string
+	len       int
+	elemSize  int
+	elemAlign int
+}
+
+// global struct
+type grec struct {
+	label string
+	size  int
+	align int
 }
 
 // local variable
@@ -36,16 +45,27 @@ type larr struct {
 	elemSize int
 }
 
+// local struct
+type lrec struct {
+	offset int
+}
+
 // string
 type str struct {
 	label string
 	value string
 }
 
+// value formatted into string
+type fmtv struct {
+	brs []*br // labels for the loops over the array and its nested arrays
+}
+
 // function
 type fn struct {
 	label     string
 	localArea int
+	retOffset int // where the hidden pointer to the struct return value is saved
 }
 
 // branch labels
@@ -54,5 +74,12 @@ type br struct {
 	elseLabel     string
 	continueLabel string
 	falseLabel    string
+	tableLabel    string
 	endLabel      string
+
+	// labels for decoding UTF-8
+	loopLabel    string
+	trimLabel    string
+	invalidLabel string
+	doneLabel    string
 }
@@ -1,6 +1,11 @@
 package gen
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/oshima/lang/ast"
 	"github.com/oshima/lang/token"
 	"github.com/oshima/lang/types"
 )
@@ -14,15 +19,54 @@ var setcc = map[token.Type]string{
 	token.GE: "setge",
 }
 
+// floatSetcc gives the instructions to set the result of comparing floats with ucomisd,
+// whose operands are swapped for < and <=.
+var floatSetcc = map[token.Type]string{
+	token.GT: "seta",
+	token.GE: "setae",
+	token.LT: "seta",
+	token.LE: "setae",
+}
+
+// unsignedSetcc gives the instructions to set the result of comparing unsigned integers.
+var unsignedSetcc = map[token.Type]string{
+	token.EQ: "sete",
+	token.NE: "setne",
+	token.LT: "setb",
+	token.LE: "setbe",
+	token.GT: "seta",
+	token.GE: "setae",
+}
+
 var paramRegs = map[int][6]string{
 	1: [6]string{"dil", "sil", "dl", "cl", "r8b", "r9b"},
+	2: [6]string{"di", "si", "dx", "cx", "r8w", "r9w"},
+	4: [6]string{"edi", "esi", "edx", "ecx", "r8d", "r9d"},
 	8: [6]string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"},
 }
 
+// raxParts gives the lower part of rax for each size.
+var raxParts = map[int]string{1: "al", 2: "ax", 4: "eax", 8: "rax"}
+
+// ptrs gives the size directive of memory operand for each size.
+var ptrs = map[int]string{1: "byte", 2: "word", 4: "dword", 8: "qword"}
+
+// stos gives the instruction to fill memory with rax for each size.
+var stos = map[int]string{1: "stosb", 2: "stosw", 4: "stosd", 8: "stosq"}
+
+var xmmRegs = [8]string{"xmm0", "xmm1", "xmm2", "xmm3", "xmm4", "xmm5", "xmm6", "xmm7"}
+
 func sizeOf(typ types.Type) int {
-	switch typ.(type) {
+	switch v := types.Underlying(typ).(type) {
 	case *types.Int:
+		if v.Size > 0 {
+			return v.Size
+		}
+		return 8
+	case *types.Float:
 		return 8
+	case *types.Char:
+		return 4
 	case *types.Bool:
 		return 1
 	case *types.String:
@@ -31,14 +75,304 @@ func sizeOf(typ types.Type) int {
 		return 8
 	case *types.Array:
 		return 8
+	case *types.Slice:
+		return 8
 	case *types.Func:
 		return 8
+	case *types.Option:
+		if nullable(v.ElemType) {
+			return 8
+		}
+		return sizeOf(&types.Tuple{ElemTypes: []types.Type{new(types.Bool), v.ElemType}})
+	case *types.Struct, *types.Tuple:
+		fields, _ := fieldsOf(v)
+		offsets := offsetsOf(v)
+		if len(fields) == 0 {
+			return 0
+		}
+		last := len(fields) - 1
+		return align(offsets[last]+sizeOf(fields[last]), alignOf(v))
+	case *types.Enum:
+		// the tag followed by the largest payload
+		size := 0
+		for _, variant := range v.Variants {
+			if n := sizeOf(&types.Tuple{ElemTypes: variant.Payload}); n > size {
+				size = n
+			}
+		}
+		return align(8+size, 8)
 	default:
 		return 0 // unreachable
 	}
 }
 
+func alignOf(typ types.Type) int {
+	if _, ok := types.Underlying(typ).(*types.Enum); ok {
+		return 8 // alignment of the tag, which is the strictest
+	}
+	fields, ok := fieldsOf(typ)
+	if !ok {
+		return sizeOf(typ)
+	}
+	// the strictest alignment of the fields
+	boundary := 1
+	for _, field := range fields {
+		if n := alignOf(field); n > boundary {
+			boundary = n
+		}
+	}
+	return boundary
+}
+
+// inMemory checks if the value of the type is stored in memory and represented by its address,
+// which is the case for structs, tuples, enums and the options with tag.
+func inMemory(typ types.Type) bool {
+	switch v := types.Underlying(typ).(type) {
+	case *types.Struct, *types.Tuple, *types.Enum:
+		return true
+	case *types.Option:
+		return !nullable(v.ElemType)
+	default:
+		return false
+	}
+}
+
+// nullable checks if the option of the type is represented by a pointer,
+// where the null pointer means none. The other options have a tag byte before the value.
+func nullable(elem types.Type) bool {
+	switch types.Underlying(elem).(type) {
+	case *types.String, *types.Array, *types.Slice, *types.Func, *types.Range:
+		return true
+	default:
+		return false
+	}
+}
+
+// signed checks if the type is a signed integer type smaller than 8 bytes, which is sign-extended on load.
+func signed(typ types.Type) bool {
+	v, ok := types.Underlying(typ).(*types.Int)
+	return ok && v.Size > 0 && v.Size < 8 && !v.Unsigned
+}
+
+// unsigned checks if the type is an unsigned integer type, which is divided and compared without sign.
+func unsigned(typ types.Type) bool {
+	v, ok := types.Underlying(typ).(*types.Int)
+	return ok && v.Unsigned
+}
+
+// isFloat checks if the value of the type is floating-point, which is passed in xmm registers.
+func isFloat(typ types.Type) bool {
+	_, ok := types.Underlying(typ).(*types.Float)
+	return ok
+}
+
+// the strings to format the values, which are emitted if necessary
+var fmtStrs = []*str{
+	{label: "fmtint", value: "%ld"},
+	{label: "fmtuint", value: "%lu"},
+	{label: "fmtfloat", value: "%g"},
+	{label: "fmtrange", value: "%ld..%ld"},
+	{label: "fmttrue", value: "true"},
+	{label: "fmtfalse", value: "false"},
+	{label: "fmtsep", value: ", "},
+}
+
+// quote returns the string literal for the assembler, where the bytes other than
+// printable ASCII are escaped in octal. The hexadecimal escapes of the assembler
+// would take all of the following hexadecimal digits.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isString(typ types.Type) bool {
+	_, ok := types.Underlying(typ).(*types.String)
+	return ok
+}
+
+// isUint64 checks if the underlying type is u64, which is out of the range of the signed conversions to and from float.
+func isUint64(typ types.Type) bool {
+	v, ok := types.Underlying(typ).(*types.Int)
+	return ok && v.Unsigned && v.Size == 8
+}
+
+// isChar checks if the underlying type is char.
+func isChar(typ types.Type) bool {
+	_, ok := types.Underlying(typ).(*types.Char)
+	return ok
+}
+
+// isSlice checks if the underlying type is slice.
+func isSlice(typ types.Type) bool {
+	_, ok := types.Underlying(typ).(*types.Slice)
+	return ok
+}
+
+// paramIndexes returns the index of the register for each parameter, which is counted separately
+// for the floats in xmm registers and the others in general registers following the hidden pointer.
+// The index is -1 for the parameter passed on the stack, after the registers run out.
+func paramIndexes(typs []types.Type, shift int) []int {
+	indexes := make([]int, len(typs))
+	gp, xmm := shift, 0
+	for i, typ := range typs {
+		switch {
+		case isFloat(typ) && xmm < len(xmmRegs):
+			indexes[i] = xmm
+			xmm++
+		case !isFloat(typ) && gp < len(paramRegs[8]):
+			indexes[i] = gp
+			gp++
+		default:
+			indexes[i] = -1
+		}
+	}
+	return indexes
+}
+
+// retRegs returns the registers to return the elements of the tuple in,
+// which are rax and rdx for integers, and xmm0 and xmm1 for floats.
+func retRegs(elemTypes []types.Type) []string {
+	gp, xmm := []string{"rax", "rdx"}, []string{"xmm0", "xmm1"}
+	regs := make([]string, len(elemTypes))
+	for i, typ := range elemTypes {
+		if isFloat(typ) {
+			regs[i], xmm = xmm[0], xmm[1:]
+		} else {
+			regs[i], gp = gp[0], gp[1:]
+		}
+	}
+	return regs
+}
+
+// fieldsOf returns the types of the fields if the type is struct or tuple.
+// The option with tag is laid out like a struct of the tag and the value.
+func fieldsOf(typ types.Type) ([]types.Type, bool) {
+	switch v := types.Underlying(typ).(type) {
+	case *types.Struct:
+		var fields []types.Type
+		for _, f := range v.Fields {
+			fields = append(fields, f.Type)
+		}
+		return fields, true
+	case *types.Tuple:
+		return v.ElemTypes, true
+	case *types.Option:
+		if nullable(v.ElemType) {
+			return nil, false
+		}
+		return []types.Type{new(types.Bool), v.ElemType}, true
+	default:
+		return nil, false
+	}
+}
+
+// offsetsOf returns the offsets of the fields from the beginning of struct or tuple.
+func offsetsOf(typ types.Type) []int {
+	fields, _ := fieldsOf(typ)
+	offsets := make([]int, len(fields))
+	offset := 0
+	for i, field := range fields {
+		offset = align(offset, alignOf(field))
+		offsets[i] = offset
+		offset += sizeOf(field)
+	}
+	return offsets
+}
+
+// offsetOf returns the offset of the field from the beginning of the struct.
+func offsetOf(s *types.Struct, name string) int {
+	offsets := offsetsOf(s)
+	for i, f := range s.Fields {
+		if f.Name == name {
+			return offsets[i]
+		}
+	}
+	return 0 // unreachable
+}
+
+// payloadOffsets returns the offsets of the payload from the beginning of enum,
+// where the payload is laid out like a tuple after the tag.
+func payloadOffsets(payload []types.Type) []int {
+	offsets := offsetsOf(&types.Tuple{ElemTypes: payload})
+	for i := range offsets {
+		offsets[i] += 8
+	}
+	return offsets
+}
+
+// inRegs checks if the value of the type is returned in rax and rdx,
+// which is the case for the tuples of two values not stored in memory.
+// The other structs, tuples and enums are returned through the hidden pointer.
+func inRegs(typ types.Type) bool {
+	v, ok := types.Underlying(typ).(*types.Tuple)
+	if !ok || len(v.ElemTypes) != 2 {
+		return false
+	}
+	for _, elem := range v.ElemTypes {
+		if inMemory(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// jumpTable returns the range of the values matched by the arms,
+// if they are integers dense enough to be dispatched through a jump table.
+func jumpTable(stmt *ast.MatchStmt) (int, int, bool) {
+	if _, ok := types.Underlying(stmt.Value.Type()).(*types.Int); !ok {
+		return 0, 0, false
+	}
+
+	var min, max, n int
+	for _, arm := range stmt.Arms {
+		for _, pat := range arm.Patterns {
+			value, ok := ast.IntValue(pat)
+			if !ok {
+				return 0, 0, false // range
+			}
+			if n == 0 || value < min {
+				min = value
+			}
+			if n == 0 || value > max {
+				max = value
+			}
+			n++
+		}
+	}
+	// at least half of the entries are used
+	if n < 4 || uint64(max-min) >= uint64(n*2) {
+		return 0, 0, false
+	}
+	return min, max, true
+}
+
 // https://en.wikipedia.org/wiki/Data_structure_alignment
 func align(n int, boundary int) int {
 	return (n + boundary - 1) & -boundary
 }
+
+// sortNodes sorts the nodes by their positions in the source code.
+// The nodes sharing the position, such as the ones cloned into the instances of generic function
+// and the values wrapped into options, are sorted by their labels.
+func sortNodes(nodes []ast.Node, label func(ast.Node) string) []ast.Node {
+	sort.Slice(nodes, func(i, j int) bool {
+		if *nodes[i].Pos() == *nodes[j].Pos() {
+			return label(nodes[i]) < label(nodes[j])
+		}
+		return nodes[i].Pos().Before(nodes[j].Pos())
+	})
+	return nodes
+}
@@ -1,20 +1,131 @@
-package main
+package lang
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
-	"os"
 
+	"github.com/oshima/lang/ast"
+	"github.com/oshima/lang/diag"
 	"github.com/oshima/lang/gen"
 	"github.com/oshima/lang/parse"
 	"github.com/oshima/lang/scan"
 	"github.com/oshima/lang/sema"
+	"github.com/oshima/lang/token"
 )
 
-func main() {
-	bytes, _ := ioutil.ReadAll(os.Stdin)
-	runes := []rune(string(bytes))
-	tokens := scan.Scan(runes)
-	prog := parse.Parse(tokens)
-	sema.Analyze(prog)
-	gen.Generate(prog)
+// Emit specifies what the compilation writes out.
+type Emit int
+
+// The list of products of the compilation.
+const (
+	EmitAsm      Emit = iota // assembly code
+	EmitTokens               // tokens from the scanner
+	EmitAST                  // AST from the parser
+	EmitTypedAST             // AST after semantic analysis
+)
+
+// Options configures the compilation.
+type Options struct {
+	Filename string                      // name of the source file used in the positions (Compile only)
+	Warnings map[diag.Code]diag.Severity // enabled warnings; diag.DefaultWarnings() if nil
+	Check    bool                        // stop after the analysis without generating code
+	Emit     Emit                        // what to write to out
+}
+
+// Result holds the products of the compilation.
+type Result struct {
+	Files    *token.FileSet
+	Program  *ast.Program   // AST after semantic analysis
+	Warnings diag.ErrorList // warnings which have not been promoted to errors
+}
+
+// Compile compiles the source code read from src and writes the assembly code to out.
+// Errors found in the source code are returned together as diag.ErrorList,
+// which also contains the warnings if any of them has been promoted to an error.
+func Compile(src io.Reader, out io.Writer, opts Options) (*Result, error) {
+	bytes, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	fset.AddFile(opts.Filename, bytes)
+	return CompileFiles(fset, out, opts)
+}
+
+// CompileFiles compiles the source files in fset as one program,
+// whose top-level statements are executed in the order of the files.
+func CompileFiles(fset *token.FileSet, out io.Writer, opts Options) (*Result, error) {
+	// each phase goes on even if the previous phases have found errors
+	var errs diag.ErrorList
+
+	prog := new(ast.Program)
+	for _, file := range fset.Files() {
+		tokens, err := scan.Scan(file)
+		if err != nil {
+			errs = append(errs, err.(diag.ErrorList)...)
+		}
+		if opts.Emit == EmitTokens {
+			for _, tok := range tokens {
+				fmt.Fprintf(out, "%s-%d,%d\t%s\t%q\n", tok.Pos, tok.End.Line, tok.End.Col, tok.Type, tok.Literal)
+			}
+			continue
+		}
+		p, err := parse.Parse(tokens)
+		if err != nil {
+			errs = append(errs, err.(diag.ErrorList)...)
+		}
+		prog.Stmts = append(prog.Stmts, p.Stmts...)
+	}
+	if opts.Emit == EmitTokens {
+		return emitted(fset, prog, errs)
+	}
+	if opts.Emit == EmitAST {
+		if err := ast.Fprint(out, prog, false); err != nil {
+			return nil, err
+		}
+		return emitted(fset, prog, errs)
+	}
+
+	if err := sema.Analyze(prog); err != nil {
+		errs = append(errs, err.(diag.ErrorList)...)
+	}
+	if len(errs) > 0 {
+		errs.Sort()
+		return nil, errs
+	}
+
+	levels := opts.Warnings
+	if levels == nil {
+		levels = diag.DefaultWarnings()
+	}
+	warns := sema.Lint(prog, levels)
+	if warns.HasErrors() {
+		return nil, warns
+	}
+
+	switch {
+	case opts.Check:
+		// no output
+	case opts.Emit == EmitTypedAST:
+		if err := ast.Fprint(out, prog, true); err != nil {
+			return nil, err
+		}
+	default:
+		if err := gen.Generate(prog, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Result{Files: fset, Program: prog, Warnings: warns}, nil
+}
+
+// emitted returns the result of the compilation stopped in the middle.
+func emitted(fset *token.FileSet, prog *ast.Program, errs diag.ErrorList) (*Result, error) {
+	if len(errs) > 0 {
+		errs.Sort()
+		return nil, errs
+	}
+	return &Result{Files: fset, Program: prog}, nil
 }
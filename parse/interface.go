@@ -6,8 +6,11 @@ import (
 )
 
 // Parse parses the input tokens and constructs the AST.
-func Parse(tokens []*token.Token) *ast.Program {
+// The AST is returned even if the tokens have syntax errors,
+// in which case the erroneous parts are replaced with BadStmt or BadExpr.
+func Parse(tokens []*token.Token) (*ast.Program, error) {
 	p := &parser{tokens: tokens, idx: -1}
 	p.next()
-	return p.parseProgram()
+	prog := p.parseProgram()
+	return prog, p.errors.Err()
 }
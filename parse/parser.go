@@ -2,10 +2,12 @@ package parse
 
 import (
 	"fmt"
-	"os"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/oshima/lang/ast"
+	"github.com/oshima/lang/diag"
 	"github.com/oshima/lang/token"
 	"github.com/oshima/lang/types"
 )
@@ -14,13 +16,22 @@ type parser struct {
 	tokens []*token.Token // input tokens
 	idx    int            // current index
 	tok    *token.Token   // current token (tokens[idx])
+	errors diag.ErrorList // errors parser has found
 }
 
+// bailout is used to abandon parsing the current statement.
+type bailout struct{}
+
 func (p *parser) next() {
 	p.idx++
 	p.tok = p.tokens[p.idx]
 }
 
+// end returns the end position of the last consumed token.
+func (p *parser) end() *token.Pos {
+	return p.tokens[p.idx-1].End
+}
+
 func (p *parser) peek() *token.Token {
 	if p.tok.Type == token.EOF {
 		return p.tok
@@ -30,13 +41,13 @@ func (p *parser) peek() *token.Token {
 
 func (p *parser) expect(typ token.Type) {
 	if p.tok.Type != typ {
-		p.error("%s: expected %s, but got %s", p.tok.Pos, typ, p.tok.Type)
+		p.bailout(diag.Syntax, p.tok.Pos, p.tok.End, "expected %s, but got %s", typ, p.tok.Type)
 	}
 }
 
 func (p *parser) consume(typ token.Type) {
 	if p.tok.Type != typ {
-		p.error("%s: expected %s, but got %s", p.tok.Pos, typ, p.tok.Type)
+		p.bailout(diag.Syntax, p.tok.Pos, p.tok.End, "expected %s, but got %s", typ, p.tok.Type)
 	}
 	p.next()
 }
@@ -48,7 +59,7 @@ func (p *parser) consumeComma(end token.Type) {
 	case end:
 		// ok
 	default:
-		p.error("%s: expected , or %s, but got %s", p.tok.Pos, end, p.tok.Type)
+		p.bailout(diag.Syntax, p.tok.Pos, p.tok.End, "expected , or %s, but got %s", end, p.tok.Type)
 	}
 }
 
@@ -59,9 +70,67 @@ func (p *parser) prec() int {
 	return LOWEST
 }
 
-func (p *parser) error(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, format+"\n", a...)
-	os.Exit(1)
+func (p *parser) error(code diag.Code, pos *token.Pos, end *token.Pos, format string, a ...interface{}) {
+	// report only the first error at the same position
+	if n := len(p.errors); n > 0 {
+		last := p.errors[n-1].Pos
+		if last.Line == pos.Line && last.Col == pos.Col {
+			return
+		}
+	}
+	p.errors.Add(code, pos, end, fmt.Sprintf(format, a...))
+}
+
+func (p *parser) badExpr(pos *token.Pos, end *token.Pos) *ast.BadExpr {
+	expr := new(ast.BadExpr)
+	expr.SetPos(pos)
+	expr.SetEnd(end)
+	return expr
+}
+
+// bailout reports an error and abandons parsing the current statement.
+func (p *parser) bailout(code diag.Code, pos *token.Pos, end *token.Pos, format string, a ...interface{}) {
+	p.error(code, pos, end, format, a...)
+	panic(bailout{})
+}
+
+// recoverStmt stops the panic caused by bailout, replaces the current statement
+// with BadStmt and skips the tokens until the beginning of the next statement.
+// It must be deferred directly at the beginning of parsing a statement.
+func (p *parser) recoverStmt(begin int, stmt *ast.Stmt) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if _, ok := r.(bailout); !ok {
+		panic(r)
+	}
+
+	bad := new(ast.BadStmt)
+	bad.SetPos(p.tokens[begin].Pos)
+	bad.SetEnd(p.tokens[begin].End)
+	*stmt = bad
+
+	// make sure to proceed at least one token
+	if p.idx == begin && p.tok.Type != token.EOF {
+		p.next()
+	}
+	for {
+		switch p.tok.Type {
+		case token.SEMICOLON:
+			p.next()
+		case token.RBRACE, token.EOF:
+		default:
+			if _, ok := stmtBegin[p.tok.Type]; !ok {
+				p.next()
+				continue
+			}
+		}
+		if p.idx > begin {
+			bad.SetEnd(p.end())
+		}
+		return
+	}
 }
 
 // ----------------------------------------------------------------
@@ -78,7 +147,9 @@ func (p *parser) parseProgram() *ast.Program {
 // ----------------------------------------------------------------
 // Stmt
 
-func (p *parser) parseStmt() ast.Stmt {
+func (p *parser) parseStmt() (stmt ast.Stmt) {
+	defer p.recoverStmt(p.idx, &stmt)
+
 	switch p.tok.Type {
 	case token.LBRACE:
 		return p.parseBlockStmt()
@@ -86,31 +157,87 @@ func (p *parser) parseStmt() ast.Stmt {
 		return p.parseVarStmt()
 	case token.FUNC:
 		return p.parseFuncStmt()
+	case token.STRUCT:
+		return p.parseStructStmt()
+	case token.ENUM:
+		return p.parseEnumStmt()
+	case token.TYPE:
+		return p.parseTypeStmt()
 	case token.IF:
 		return p.parseIfStmt()
 	case token.WHILE:
 		return p.parseWhileStmt()
 	case token.FOR:
 		return p.parseForStmt()
+	case token.MATCH:
+		return p.parseMatchStmt()
 	case token.CONTINUE:
 		return p.parseContinueStmt()
 	case token.BREAK:
 		return p.parseBreakStmt()
 	case token.RETURN:
 		return p.parseReturnStmt()
+	case token.IDENT:
+		p.misspelledKeyword()
+		return p.parseAssignStmtOrExprStmt()
 	default:
 		return p.parseAssignStmtOrExprStmt()
 	}
 }
 
+// misspelledKeyword checks if the current identifier is likely a misspelled keyword,
+// in which case the identifier is reported with the suggested keywords, and the statement is abandoned.
+func (p *parser) misspelledKeyword() {
+	// an identifier followed by an operand cannot begin a statement
+	switch p.peek().Type {
+	case token.IDENT, token.NUMBER, token.QUOTED, token.QUOTEDCHAR, token.TRUE, token.FALSE, token.NONE:
+	default:
+		return
+	}
+
+	var names []string
+	for name := range stmtKeywords {
+		names = append(names, name)
+	}
+	kws := diag.Suggest(p.tok.Literal, names)
+	if len(kws) == 0 {
+		return
+	}
+	err := p.errors.Add(diag.Syntax, p.tok.Pos, p.tok.End, fmt.Sprintf("unexpected identifier %s", p.tok.Literal))
+	for _, kw := range kws {
+		err.AddNote(p.tok.Pos, p.tok.End, fmt.Sprintf("did you mean %s?", kw))
+	}
+
+	// skip the statement together with its block, which cannot be parsed without the keyword
+	for depth := 0; p.tok.Type != token.EOF; p.next() {
+		switch p.tok.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth--; depth == 0 {
+				p.next()
+			}
+			if depth <= 0 {
+				panic(bailout{})
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				panic(bailout{})
+			}
+		}
+	}
+	panic(bailout{})
+}
+
 func (p *parser) parseBlockStmt() *ast.BlockStmt {
 	stmt := new(ast.BlockStmt)
 	stmt.SetPos(p.tok.Pos)
 	p.next()
-	for p.tok.Type != token.RBRACE {
+	for p.tok.Type != token.RBRACE && p.tok.Type != token.EOF {
 		stmt.Stmts = append(stmt.Stmts, p.parseStmt())
 	}
-	p.next()
+	p.consume(token.RBRACE)
+	stmt.SetEnd(p.end())
 	return stmt
 }
 
@@ -118,15 +245,38 @@ func (p *parser) parseVarStmt() *ast.VarStmt {
 	stmt := new(ast.VarStmt)
 	stmt.SetPos(p.tok.Pos)
 	p.next()
+	// destructuring
+	if p.tok.Type == token.IDENT && p.peek().Type == token.COMMA {
+		for {
+			p.expect(token.IDENT)
+			v := new(ast.VarDecl)
+			v.SetPos(p.tok.Pos)
+			v.Name = p.tok.Literal
+			p.next()
+			v.SetEnd(p.end())
+			stmt.Vars = append(stmt.Vars, v)
+			if p.tok.Type != token.COMMA {
+				break
+			}
+			p.next()
+		}
+		p.consume(token.ASSIGN)
+		stmt.Value = p.parseExprList()
+		p.consume(token.SEMICOLON)
+		stmt.SetEnd(p.end())
+		return stmt
+	}
 	for p.tok.Type != token.SEMICOLON {
 		v := p.parseVarDecl()
 		if v.Value == nil {
-			p.error("%s: %s has no initial value", v.Pos(), v.Name)
+			p.error(diag.MissingInitValue, v.Pos(), v.End(), "%s has no initial value", v.Name)
+			v.Value = p.badExpr(v.Pos(), v.End())
 		}
 		stmt.Vars = append(stmt.Vars, v)
 		p.consumeComma(token.SEMICOLON)
 	}
 	p.next()
+	stmt.SetEnd(p.end())
 	return stmt
 }
 
@@ -135,6 +285,35 @@ func (p *parser) parseFuncStmt() *ast.FuncStmt {
 	stmt.SetPos(p.tok.Pos)
 	p.next()
 	stmt.Func = p.parseFuncDecl()
+	stmt.SetEnd(p.end())
+	return stmt
+}
+
+func (p *parser) parseStructStmt() *ast.StructStmt {
+	stmt := new(ast.StructStmt)
+	stmt.SetPos(p.tok.Pos)
+	p.next()
+	stmt.Struct = p.parseStructDecl()
+	stmt.SetEnd(p.end())
+	return stmt
+}
+
+func (p *parser) parseEnumStmt() *ast.EnumStmt {
+	stmt := new(ast.EnumStmt)
+	stmt.SetPos(p.tok.Pos)
+	p.next()
+	stmt.Enum = p.parseEnumDecl()
+	stmt.SetEnd(p.end())
+	return stmt
+}
+
+func (p *parser) parseTypeStmt() *ast.TypeStmt {
+	stmt := new(ast.TypeStmt)
+	stmt.SetPos(p.tok.Pos)
+	p.next()
+	stmt.Type = p.parseTypeDecl()
+	p.consume(token.SEMICOLON)
+	stmt.SetEnd(p.end())
 	return stmt
 }
 
@@ -142,10 +321,15 @@ func (p *parser) parseIfStmt() *ast.IfStmt {
 	stmt := new(ast.IfStmt)
 	stmt.SetPos(p.tok.Pos)
 	p.next()
-	stmt.Cond = p.parseExpr(LOWEST)
+	if p.tok.Type == token.VAR {
+		stmt.Var = p.parseIfVar()
+	} else {
+		stmt.Cond = p.parseExpr(LOWEST)
+	}
 	p.expect(token.LBRACE)
 	stmt.Body = p.parseBlockStmt()
 	if p.tok.Type != token.ELSE {
+		stmt.SetEnd(p.end())
 		return stmt
 	}
 	p.next()
@@ -155,11 +339,26 @@ func (p *parser) parseIfStmt() *ast.IfStmt {
 	case token.IF:
 		stmt.Else = p.parseIfStmt()
 	default:
-		p.error("%s: expected { or if, but got %s", p.tok.Pos, p.tok.Type)
+		p.bailout(diag.Syntax, p.tok.Pos, p.tok.End, "expected { or if, but got %s", p.tok.Type)
 	}
+	stmt.SetEnd(p.end())
 	return stmt
 }
 
+// parseIfVar parses the variable bound to the content of the option, like var x = maybe.
+func (p *parser) parseIfVar() *ast.VarDecl {
+	p.next()
+	p.expect(token.IDENT)
+	v := new(ast.VarDecl)
+	v.SetPos(p.tok.Pos)
+	v.Name = p.tok.Literal
+	p.next()
+	v.SetEnd(p.end())
+	p.consume(token.ASSIGN)
+	v.Value = p.parseExpr(LOWEST)
+	return v
+}
+
 func (p *parser) parseWhileStmt() *ast.WhileStmt {
 	stmt := new(ast.WhileStmt)
 	stmt.SetPos(p.tok.Pos)
@@ -167,6 +366,7 @@ func (p *parser) parseWhileStmt() *ast.WhileStmt {
 	stmt.Cond = p.parseExpr(LOWEST)
 	p.expect(token.LBRACE)
 	stmt.Body = p.parseBlockStmt()
+	stmt.SetEnd(p.end())
 	return stmt
 }
 
@@ -176,27 +376,80 @@ func (p *parser) parseForStmt() *ast.ForStmt {
 	p.next()
 	p.expect(token.IDENT)
 	stmt.Elem = &ast.VarDecl{Name: p.tok.Literal}
+	stmt.Elem.SetPos(p.tok.Pos)
+	stmt.Elem.SetEnd(p.tok.End)
 	p.next()
 	if p.tok.Type == token.COMMA {
 		p.next()
 		p.expect(token.IDENT)
 		stmt.Index = &ast.VarDecl{Name: p.tok.Literal}
+		stmt.Index.SetPos(p.tok.Pos)
+		stmt.Index.SetEnd(p.tok.End)
 		p.next()
 	} else {
+		// implicit index right after the element
 		stmt.Index = &ast.VarDecl{}
+		stmt.Index.SetPos(stmt.Elem.End())
+		stmt.Index.SetEnd(stmt.Elem.End())
 	}
 	p.consume(token.IN)
 	stmt.Iter = &ast.VarDecl{Value: p.parseExpr(LOWEST)}
+	stmt.Iter.SetPos(stmt.Iter.Value.Pos())
+	stmt.Iter.SetEnd(stmt.Iter.Value.End())
 	p.expect(token.LBRACE)
 	stmt.Body = p.parseBlockStmt()
+	stmt.SetEnd(p.end())
+	return stmt
+}
+
+func (p *parser) parseMatchStmt() *ast.MatchStmt {
+	stmt := new(ast.MatchStmt)
+	stmt.SetPos(p.tok.Pos)
+	p.next()
+	stmt.Value = p.parseExpr(LOWEST)
+	p.consume(token.LBRACE)
+	for p.tok.Type != token.RBRACE {
+		stmt.Arms = append(stmt.Arms, p.parseMatchArm())
+	}
+	p.next()
+	stmt.SetEnd(p.end())
 	return stmt
 }
 
+func (p *parser) parseMatchArm() *ast.MatchArm {
+	arm := new(ast.MatchArm)
+	arm.SetPos(p.tok.Pos)
+	if p.tok.Type == token.IDENT && p.tok.Literal == "_" {
+		p.next()
+	} else {
+		for {
+			arm.Patterns = append(arm.Patterns, p.parsePattern())
+			if p.tok.Type != token.COMMA {
+				break
+			}
+			p.next()
+		}
+	}
+	if len(arm.Patterns) > 1 {
+		for _, pat := range arm.Patterns {
+			if v, ok := pat.(*ast.VariantPattern); ok && len(v.Bindings) > 0 {
+				p.error(diag.InvalidPattern, v.Pos(), v.End(), "cannot bind variables in arm with multiple patterns")
+			}
+		}
+	}
+	p.consume(token.FATARROW)
+	p.expect(token.LBRACE)
+	arm.Body = p.parseBlockStmt()
+	arm.SetEnd(p.end())
+	return arm
+}
+
 func (p *parser) parseContinueStmt() *ast.ContinueStmt {
 	stmt := new(ast.ContinueStmt)
 	stmt.SetPos(p.tok.Pos)
 	p.next()
 	p.consume(token.SEMICOLON)
+	stmt.SetEnd(p.end())
 	return stmt
 }
 
@@ -205,6 +458,7 @@ func (p *parser) parseBreakStmt() *ast.BreakStmt {
 	stmt.SetPos(p.tok.Pos)
 	p.next()
 	p.consume(token.SEMICOLON)
+	stmt.SetEnd(p.end())
 	return stmt
 }
 
@@ -214,30 +468,38 @@ func (p *parser) parseReturnStmt() *ast.ReturnStmt {
 	p.next()
 	if p.tok.Type == token.SEMICOLON {
 		p.next()
+		stmt.SetEnd(p.end())
 		return stmt
 	}
-	stmt.Value = p.parseExpr(LOWEST)
+	stmt.Value = p.parseExprList()
 	p.consume(token.SEMICOLON)
+	stmt.SetEnd(p.end())
 	return stmt
 }
 
 func (p *parser) parseAssignStmtOrExprStmt() ast.Stmt {
 	pos := p.tok.Pos
-	expr := p.parseExpr(LOWEST)
+	expr := p.parseExprList()
+	if v, ok := expr.(*ast.TupleLit); ok {
+		// destructuring assignment
+		p.expect(token.ASSIGN)
+		for _, target := range v.Elems {
+			p.checkTarget(target)
+		}
+	}
 	// AssignStmt
 	if _, ok := assignOps[p.tok.Type]; ok {
 		stmt := new(ast.AssignStmt)
-		switch expr.(type) {
-		case *ast.Ident, *ast.IndexExpr:
-			stmt.Target = expr
-		default:
-			p.error("%s: invalid target in assignment", expr.Pos())
+		if _, ok := expr.(*ast.TupleLit); !ok {
+			p.checkTarget(expr)
 		}
-		stmt.SetPos(p.tok.Pos)
+		stmt.Target = expr
+		stmt.SetPos(pos)
 		stmt.Op = p.tok.Type
 		p.next()
-		stmt.Value = p.parseExpr(LOWEST)
+		stmt.Value = p.parseExprList()
 		p.consume(token.SEMICOLON)
+		stmt.SetEnd(p.end())
 		return stmt
 	}
 	// ExprStmt
@@ -245,32 +507,84 @@ func (p *parser) parseAssignStmtOrExprStmt() ast.Stmt {
 	stmt.SetPos(pos)
 	stmt.Expr = expr
 	p.consume(token.SEMICOLON)
+	stmt.SetEnd(p.end())
 	return stmt
 }
 
+func (p *parser) checkTarget(expr ast.Expr) {
+	switch expr.(type) {
+	case *ast.Ident, *ast.IndexExpr, *ast.FieldExpr, *ast.BadExpr:
+		// ok
+	default:
+		p.error(diag.InvalidTarget, expr.Pos(), expr.End(), "invalid target in assignment")
+	}
+}
+
 // ----------------------------------------------------------------
 // Expr
 
+// parseExprList parses the expressions separated by commas,
+// which make a tuple if there are two or more.
+func (p *parser) parseExprList() ast.Expr {
+	expr := p.parseExpr(LOWEST)
+	if p.tok.Type != token.COMMA {
+		return expr
+	}
+	tuple := new(ast.TupleLit)
+	tuple.SetPos(expr.Pos())
+	tuple.Elems = append(tuple.Elems, expr)
+	for p.tok.Type == token.COMMA {
+		p.next()
+		tuple.Elems = append(tuple.Elems, p.parseExpr(LOWEST))
+	}
+	tuple.SetEnd(p.end())
+	return tuple
+}
+
 func (p *parser) parseExpr(prec int) ast.Expr {
 	var expr ast.Expr
 
 	switch p.tok.Type {
-	case token.BANG, token.MINUS:
+	case token.BANG, token.MINUS, token.TILDE:
 		expr = p.parsePrefixExpr()
 	case token.IDENT:
+		if p.structLitBegins() {
+			expr = p.parseStructLit()
+		} else {
+			expr = p.parseIdent()
+		}
+	case token.INT, token.FLOAT, token.CHAR, token.BOOL, token.STRING:
+		// conversion to the basic type, such as int(x)
+		if p.peek().Type != token.LPAREN {
+			p.error(diag.Syntax, p.tok.Pos, p.tok.End, "unexpected %s", p.tok.Type)
+			expr = p.badExpr(p.tok.Pos, p.tok.End)
+			p.next()
+			break
+		}
 		expr = p.parseIdent()
 	case token.NUMBER:
-		expr = p.parseIntLit()
+		if isFloatLit(p.tok.Literal) {
+			expr = p.parseFloatLit()
+		} else {
+			expr = p.parseIntLit()
+		}
 	case token.TRUE, token.FALSE:
 		expr = p.parseBoolLit()
+	case token.NONE:
+		expr = p.parseNoneLit()
 	case token.QUOTED:
 		expr = p.parseStringLit()
+	case token.QUOTEDHEAD:
+		expr = p.parseInterpolation()
+	case token.QUOTEDCHAR:
+		expr = p.parseCharLit()
 	case token.LBRACK:
-		expr = p.parseArrayLitOrArrayShortLit()
+		expr = p.parseArrayLitOrArrayShortLitOrSliceLit()
 	case token.LPAREN:
 		expr = p.parseFuncLitOrGroupedExpr()
 	default:
-		p.error("%s: unexpected %s", p.tok.Pos, p.tok.Type)
+		p.error(diag.Syntax, p.tok.Pos, p.tok.End, "unexpected %s", p.tok.Type)
+		expr = p.badExpr(p.tok.Pos, p.tok.End)
 	}
 
 	for p.prec() > prec {
@@ -279,6 +593,8 @@ func (p *parser) parseExpr(prec int) ast.Expr {
 			expr = p.parseIndexExpr(expr)
 		case token.LPAREN:
 			expr = p.parseCallExprOrLibCallExpr(expr)
+		case token.DOT:
+			expr = p.parseFieldExpr(expr)
 		case token.BETWEEN:
 			expr = p.parseRangeLit(expr)
 		default:
@@ -295,32 +611,47 @@ func (p *parser) parsePrefixExpr() *ast.PrefixExpr {
 	expr.Op = p.tok.Type
 	p.next()
 	expr.Right = p.parseExpr(PREFIX)
+	expr.SetEnd(p.end())
 	return expr
 }
 
 func (p *parser) parseInfixExpr(left ast.Expr) *ast.InfixExpr {
 	expr := new(ast.InfixExpr)
 	expr.Left = left
-	expr.SetPos(p.tok.Pos)
+	expr.SetPos(left.Pos())
 	expr.Op = p.tok.Type
 	prec := p.prec()
 	p.next()
 	expr.Right = p.parseExpr(prec)
+	expr.SetEnd(p.end())
 	return expr
 }
 
 func (p *parser) parseIndexExpr(left ast.Expr) *ast.IndexExpr {
 	expr := new(ast.IndexExpr)
 	expr.Left = left
-	expr.SetPos(p.tok.Pos)
+	expr.SetPos(left.Pos())
 	p.next()
 	expr.Index = p.parseExpr(LOWEST)
 	p.consume(token.RBRACK)
+	expr.SetEnd(p.end())
+	return expr
+}
+
+func (p *parser) parseFieldExpr(left ast.Expr) *ast.FieldExpr {
+	expr := new(ast.FieldExpr)
+	expr.Left = left
+	expr.SetPos(left.Pos())
+	p.next()
+	p.expect(token.IDENT)
+	expr.Name = p.tok.Literal
+	p.next()
+	expr.SetEnd(p.end())
 	return expr
 }
 
 func (p *parser) parseCallExprOrLibCallExpr(left ast.Expr) ast.Expr {
-	pos := p.tok.Pos
+	pos := left.Pos()
 	p.next()
 	params := make([]ast.Expr, 0, 4)
 	for p.tok.Type != token.RPAREN {
@@ -335,6 +666,7 @@ func (p *parser) parseCallExprOrLibCallExpr(left ast.Expr) ast.Expr {
 			expr.Name = v.Name
 			expr.SetPos(pos)
 			expr.Params = params
+			expr.SetEnd(p.end())
 			return expr
 		}
 	}
@@ -343,6 +675,7 @@ func (p *parser) parseCallExprOrLibCallExpr(left ast.Expr) ast.Expr {
 	expr.Left = left
 	expr.SetPos(pos)
 	expr.Params = params
+	expr.SetEnd(p.end())
 	return expr
 }
 
@@ -351,18 +684,68 @@ func (p *parser) parseIdent() *ast.Ident {
 	expr.SetPos(p.tok.Pos)
 	expr.Name = p.tok.Literal
 	p.next()
+	expr.SetEnd(p.end())
+	return expr
+}
+
+// structLitBegins checks if the current identifier begins a struct literal.
+// A brace after an identifier may also begin the body of if, while or for,
+// so the literal must be followed by a field name and a colon.
+func (p *parser) structLitBegins() bool {
+	if p.idx+3 >= len(p.tokens) {
+		return false
+	}
+	return p.tokens[p.idx+1].Type == token.LBRACE &&
+		p.tokens[p.idx+2].Type == token.IDENT &&
+		p.tokens[p.idx+3].Type == token.COLON
+}
+
+func (p *parser) parseStructLit() *ast.StructLit {
+	expr := new(ast.StructLit)
+	expr.SetPos(p.tok.Pos)
+	expr.Name = p.tok.Literal
+	p.next()
+	p.next()
+	for p.tok.Type != token.RBRACE {
+		p.expect(token.IDENT)
+		field := new(ast.VarDecl)
+		field.SetPos(p.tok.Pos)
+		field.Name = p.tok.Literal
+		p.next()
+		p.consume(token.COLON)
+		field.Value = p.parseExpr(LOWEST)
+		field.SetEnd(p.end())
+		expr.Fields = append(expr.Fields, field)
+		p.consumeComma(token.RBRACE)
+	}
+	p.next()
+	expr.SetEnd(p.end())
 	return expr
 }
 
 func (p *parser) parseIntLit() *ast.IntLit {
 	expr := new(ast.IntLit)
 	expr.SetPos(p.tok.Pos)
-	value, err := strconv.Atoi(p.tok.Literal)
+	value, err := parseInt(p.tok.Literal)
+	if err != nil {
+		p.error(diag.InvalidInteger, p.tok.Pos, p.tok.End, "cannot parse %s as integer", p.tok.Literal)
+	}
+	expr.Value = value
+	p.next()
+	expr.SetEnd(p.end())
+	return expr
+}
+
+func (p *parser) parseFloatLit() *ast.FloatLit {
+	expr := new(ast.FloatLit)
+	expr.SetPos(p.tok.Pos)
+	value, err := strconv.ParseFloat(p.tok.Literal, 64)
 	if err != nil {
-		p.error("%s: cannot parse %s as integer", p.tok.Pos, p.tok.Literal)
+		p.error(diag.InvalidFloat, p.tok.Pos, p.tok.End, "cannot parse %s as float", p.tok.Literal)
 	}
 	expr.Value = value
 	p.next()
+	expr.SetEnd(p.end())
 	return expr
 }
 
@@ -371,58 +754,189 @@ func (p *parser) parseBoolLit() *ast.BoolLit {
 	expr.SetPos(p.tok.Pos)
 	expr.Value = p.tok.Type == token.TRUE
 	p.next()
+	expr.SetEnd(p.end())
+	return expr
+}
+
+func (p *parser) parseNoneLit() *ast.NoneLit {
+	expr := new(ast.NoneLit)
+	expr.SetPos(p.tok.Pos)
+	p.next()
+	expr.SetEnd(p.end())
 	return expr
 }
 
 func (p *parser) parseStringLit() *ast.StringLit {
 	expr := new(ast.StringLit)
 	expr.SetPos(p.tok.Pos)
-	escaped := false
-	for _, ch := range p.tok.Literal {
-		if escaped {
-			if unescaped, ok := unescape[ch]; ok {
-				expr.Value += string(unescaped)
-				escaped = false
-			} else {
-				p.error("%s: unknown escape sequence \\%c", p.tok.Pos, ch)
-			}
+	if strings.HasPrefix(p.tok.Literal, "`") {
+		// raw string, where carriage returns are discarded
+		raw := strings.TrimSuffix(strings.TrimPrefix(p.tok.Literal, "`"), "`")
+		expr.Value = strings.Replace(raw, "\r", "", -1)
+	} else {
+		expr.Value = p.unquote(strings.TrimSuffix(strings.TrimPrefix(p.tok.Literal, `"`), `"`))
+	}
+	p.next()
+	expr.SetEnd(p.end())
+	return expr
+}
+
+// parseInterpolation parses the string with the embedded expressions, which is desugared
+// into the call to format the pieces of the string and the values of the expressions in order.
+func (p *parser) parseInterpolation() *ast.LibCallExpr {
+	expr := new(ast.LibCallExpr)
+	expr.SetPos(p.tok.Pos)
+	expr.Name = "format"
+	for {
+		// "...${, }...${ or }..."
+		piece := new(ast.StringLit)
+		piece.SetPos(p.tok.Pos)
+		lit := strings.TrimPrefix(strings.TrimPrefix(p.tok.Literal, `"`), "}")
+		piece.Value = p.unquote(strings.TrimSuffix(strings.TrimSuffix(lit, `"`), "${"))
+		last := p.tok.Type == token.QUOTEDTAIL
+		p.next()
+		piece.SetEnd(p.end())
+		if piece.Value != "" {
+			expr.Params = append(expr.Params, piece)
+		}
+		if last {
+			break
+		}
+
+		expr.Params = append(expr.Params, p.parseExpr(LOWEST))
+		if p.tok.Type != token.QUOTEDMID && p.tok.Type != token.QUOTEDTAIL {
+			p.bailout(diag.Syntax, p.tok.Pos, p.tok.End, "expected }, but got %s", p.tok.Type)
+		}
+	}
+	expr.SetEnd(p.end())
+	return expr
+}
+
+// unquote replaces the escape sequences in the quoted characters.
+// \xNN gives the byte as it is, which may be a part of UTF-8.
+// The null character is rejected, since it would terminate the string.
+func (p *parser) unquote(lit string) string {
+	var b strings.Builder
+	for i := 0; i < len(lit); {
+		if lit[i] != '\\' {
+			b.WriteByte(lit[i])
+			i++
+			continue
+		}
+		ch, n := p.unescape(lit[i+1:])
+		if ch == 0 && n > 0 {
+			p.error(diag.NullChar, p.tok.Pos, p.tok.End, "strings cannot contain the null character")
+		} else if strings.HasPrefix(lit[i+1:], "x") {
+			b.WriteByte(byte(ch))
 		} else {
-			if ch == '"' {
-				continue
-			} else if ch == '\\' {
-				escaped = true
-			} else {
-				expr.Value += string(ch)
+			b.WriteRune(ch)
+		}
+		i += 1 + n
+	}
+	return b.String()
+}
+
+// unescape reads the escape sequence following a backslash at the beginning of s,
+// and returns the character it represents and the length of the sequence.
+func (p *parser) unescape(s string) (rune, int) {
+	if s == "" {
+		return 0, 0 // unterminated, which the scanner has reported
+	}
+	ch, n := utf8.DecodeRuneInString(s)
+	switch ch {
+	case 'x':
+		if len(s) >= 3 {
+			if code, err := strconv.ParseUint(s[1:3], 16, 8); err == nil {
+				return rune(code), 3
 			}
 		}
+		p.error(diag.UnknownEscape, p.tok.Pos, p.tok.End, "\\x must be followed by two hexadecimal digits")
+		return 0, n
+	case 'u':
+		end := strings.IndexByte(s, '}')
+		if !strings.HasPrefix(s, "u{") || end < 3 || end > 8 {
+			p.error(diag.UnknownEscape, p.tok.Pos, p.tok.End, "\\u must be followed by hexadecimal digits in braces")
+			return 0, n
+		}
+		code, err := strconv.ParseUint(s[2:end], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			p.error(diag.UnknownEscape, p.tok.Pos, p.tok.End, "invalid code point %s", s[2:end])
+		}
+		return rune(code), end + 1
+	}
+	if unescaped, ok := unescape[ch]; ok {
+		return unescaped, n
+	}
+	p.error(diag.UnknownEscape, p.tok.Pos, p.tok.End, "unknown escape sequence \\%c", ch)
+	return ch, n
+}
+
+func (p *parser) parseCharLit() *ast.CharLit {
+	expr := new(ast.CharLit)
+	expr.SetPos(p.tok.Pos)
+	var chars []rune
+	lit := strings.TrimSuffix(strings.TrimPrefix(p.tok.Literal, "'"), "'")
+	for i := 0; i < len(lit); {
+		if lit[i] != '\\' {
+			ch, n := utf8.DecodeRuneInString(lit[i:])
+			chars = append(chars, ch)
+			i += n
+			continue
+		}
+		// \xNN gives the character of the code point, unlike in strings
+		ch, n := p.unescape(lit[i+1:])
+		chars = append(chars, ch)
+		i += 1 + n
+	}
+	if len(chars) == 1 {
+		expr.Value = chars[0]
+	} else {
+		p.error(diag.InvalidCharLit, p.tok.Pos, p.tok.End, "character literal must contain one character")
 	}
 	p.next()
+	expr.SetEnd(p.end())
 	return expr
 }
 
 func (p *parser) parseRangeLit(lower ast.Expr) *ast.RangeLit {
 	expr := new(ast.RangeLit)
 	expr.Lower = lower
-	expr.SetPos(p.tok.Pos)
+	expr.SetPos(lower.Pos())
 	p.next()
 	expr.Upper = p.parseExpr(BETWEEN)
+	expr.SetEnd(p.end())
 	return expr
 }
 
-func (p *parser) parseArrayLitOrArrayShortLit() ast.Expr {
+func (p *parser) parseArrayLitOrArrayShortLitOrSliceLit() ast.Expr {
 	pos := p.tok.Pos
 	p.next()
+	// SliceLit
+	if p.tok.Type == token.RBRACK {
+		expr := new(ast.SliceLit)
+		expr.SetPos(pos)
+		p.next()
+		expr.ElemType = p.parseType()
+		p.consume(token.LPAREN)
+		if p.tok.Type != token.RPAREN {
+			expr.Value = p.parseExpr(LOWEST)
+			p.expect(token.RPAREN)
+		}
+		p.next()
+		expr.SetEnd(p.end())
+		return expr
+	}
 	pick := p.parseExpr(LOWEST)
 	// ArrayShortLit
 	if p.tok.Type == token.RBRACK {
 		if _, ok := typeBegin[p.peek().Type]; ok {
 			expr := new(ast.ArrayShortLit)
 			expr.SetPos(pos)
-			i, ok := pick.(*ast.IntLit)
-			if !ok || i.Value < 0 {
-				p.error("%s: array length must be non-negative number", i.Pos())
+			if i, ok := pick.(*ast.IntLit); ok && i.Value >= 0 {
+				expr.Len = i.Value
+			} else {
+				p.error(diag.InvalidArrayLen, pick.Pos(), pick.End(), "array length must be non-negative number")
 			}
-			expr.Len = i.Value
 			p.next()
 			expr.ElemType = p.parseType()
 			p.consume(token.LPAREN)
@@ -431,6 +945,7 @@ func (p *parser) parseArrayLitOrArrayShortLit() ast.Expr {
 				p.expect(token.RPAREN)
 			}
 			p.next()
+			expr.SetEnd(p.end())
 			return expr
 		}
 	}
@@ -444,6 +959,7 @@ func (p *parser) parseArrayLitOrArrayShortLit() ast.Expr {
 		p.consumeComma(token.RBRACK)
 	}
 	p.next()
+	expr.SetEnd(p.end())
 	return expr
 }
 
@@ -457,10 +973,11 @@ func (p *parser) parseFuncLitOrGroupedExpr() ast.Expr {
 		for p.tok.Type != token.RPAREN {
 			param := p.parseVarDecl()
 			if param.VarType == nil {
-				p.error("%s: type of %s must be annotated", param.Pos(), param.Name)
+				p.error(diag.MissingParamType, param.Pos(), param.End(), "type of %s must be annotated", param.Name)
+				param.VarType = new(types.Invalid)
 			}
 			if param.Value != nil {
-				p.error("%s: %s cannot have initial value", param.Pos(), param.Name)
+				p.error(diag.ParamInitValue, param.Pos(), param.End(), "%s cannot have initial value", param.Name)
 			}
 			expr.Params = append(expr.Params, param)
 			p.consumeComma(token.RPAREN)
@@ -472,12 +989,79 @@ func (p *parser) parseFuncLitOrGroupedExpr() ast.Expr {
 			p.expect(token.LBRACE)
 		}
 		expr.Body = p.parseBlockStmt()
+		expr.SetEnd(p.end())
 		return expr
 	}
 	// grouped expression
 	expr := p.parseExpr(LOWEST)
-	p.consume(token.RPAREN)
-	return expr
+	if p.tok.Type == token.RPAREN {
+		p.next()
+		return expr
+	}
+	// TupleLit
+	tuple := new(ast.TupleLit)
+	tuple.SetPos(pos)
+	tuple.Elems = append(tuple.Elems, expr)
+	for p.tok.Type != token.RPAREN {
+		p.consume(token.COMMA)
+		tuple.Elems = append(tuple.Elems, p.parseExpr(LOWEST))
+	}
+	p.next()
+	tuple.SetEnd(p.end())
+	return tuple
+}
+
+// ----------------------------------------------------------------
+// Pattern
+
+func (p *parser) parsePattern() ast.Expr {
+	if p.tok.Type == token.IDENT {
+		return p.parseVariantPattern()
+	}
+	pat := p.parseExpr(LOWEST)
+	p.checkPattern(pat)
+	return pat
+}
+
+// checkPattern reports the pattern which is not a literal of int, string or range.
+func (p *parser) checkPattern(expr ast.Expr) {
+	switch v := expr.(type) {
+	case *ast.IntLit, *ast.StringLit, *ast.BadExpr:
+		// ok
+	case *ast.PrefixExpr:
+		if _, ok := v.Right.(*ast.IntLit); !ok || v.Op != token.MINUS {
+			p.error(diag.InvalidPattern, expr.Pos(), expr.End(), "invalid pattern")
+		}
+	case *ast.RangeLit:
+		p.checkPattern(v.Lower)
+		p.checkPattern(v.Upper)
+	default:
+		p.error(diag.InvalidPattern, expr.Pos(), expr.End(), "invalid pattern")
+	}
+}
+
+func (p *parser) parseVariantPattern() *ast.VariantPattern {
+	pat := new(ast.VariantPattern)
+	pat.SetPos(p.tok.Pos)
+	pat.Name = p.tok.Literal
+	p.next()
+	if p.tok.Type != token.LPAREN {
+		pat.SetEnd(p.end())
+		return pat
+	}
+	p.next()
+	for p.tok.Type != token.RPAREN {
+		p.expect(token.IDENT)
+		binding := &ast.VarDecl{Name: p.tok.Literal}
+		binding.SetPos(p.tok.Pos)
+		binding.SetEnd(p.tok.End)
+		pat.Bindings = append(pat.Bindings, binding)
+		p.next()
+		p.consumeComma(token.RPAREN)
+	}
+	p.next()
+	pat.SetEnd(p.end())
+	return pat
 }
 
 // ----------------------------------------------------------------
@@ -490,7 +1074,7 @@ func (p *parser) parseVarDecl() *ast.VarDecl {
 	decl.Name = p.tok.Literal
 	p.next()
 	if p.tok.Type != token.COLON && p.tok.Type != token.ASSIGN {
-		p.error("%s: unexpected %s", p.tok.Pos, p.tok.Type)
+		p.bailout(diag.Syntax, p.tok.Pos, p.tok.End, "unexpected %s", p.tok.Type)
 	}
 	if p.tok.Type == token.COLON {
 		p.next()
@@ -500,6 +1084,7 @@ func (p *parser) parseVarDecl() *ast.VarDecl {
 		p.next()
 		decl.Value = p.parseExpr(LOWEST)
 	}
+	decl.SetEnd(p.end())
 	return decl
 }
 
@@ -509,14 +1094,27 @@ func (p *parser) parseFuncDecl() *ast.FuncDecl {
 	decl.SetPos(p.tok.Pos)
 	decl.Name = p.tok.Literal
 	p.next()
+	if p.tok.Type == token.LBRACK {
+		pos := p.tok.Pos
+		p.next()
+		for p.tok.Type != token.RBRACK {
+			decl.TypeParams = append(decl.TypeParams, p.parseTypeParamDecl())
+			p.consumeComma(token.RBRACK)
+		}
+		p.next()
+		if len(decl.TypeParams) == 0 {
+			p.error(diag.Syntax, pos, p.end(), "empty type parameter list")
+		}
+	}
 	p.consume(token.LPAREN)
 	for p.tok.Type != token.RPAREN {
 		param := p.parseVarDecl()
 		if param.VarType == nil {
-			p.error("%s: type of %s must be annotated", param.Pos(), param.Name)
+			p.error(diag.MissingParamType, param.Pos(), param.End(), "type of %s must be annotated", param.Name)
+			param.VarType = new(types.Invalid)
 		}
 		if param.Value != nil {
-			p.error("%s: %s cannot have initial value", param.Pos(), param.Name)
+			p.error(diag.ParamInitValue, param.Pos(), param.End(), "%s cannot have initial value", param.Name)
 		}
 		decl.Params = append(decl.Params, param)
 		p.consumeComma(token.RPAREN)
@@ -528,6 +1126,98 @@ func (p *parser) parseFuncDecl() *ast.FuncDecl {
 		p.expect(token.LBRACE)
 	}
 	decl.Body = p.parseBlockStmt()
+	decl.SetEnd(p.end())
+	return decl
+}
+
+func (p *parser) parseTypeParamDecl() *ast.TypeParamDecl {
+	p.expect(token.IDENT)
+	decl := new(ast.TypeParamDecl)
+	decl.SetPos(p.tok.Pos)
+	decl.SetEnd(p.tok.End)
+	decl.Name = p.tok.Literal
+	decl.Type = &types.TypeParam{Name: decl.Name}
+	p.next()
+	return decl
+}
+
+func (p *parser) parseStructDecl() *ast.StructDecl {
+	p.expect(token.IDENT)
+	decl := new(ast.StructDecl)
+	decl.SetPos(p.tok.Pos)
+	decl.Name = p.tok.Literal
+	decl.Type = &types.Struct{Name: decl.Name}
+	p.next()
+	p.consume(token.LBRACE)
+	for p.tok.Type != token.RBRACE {
+		field := p.parseVarDecl()
+		if field.VarType == nil {
+			p.error(diag.MissingParamType, field.Pos(), field.End(), "type of %s must be annotated", field.Name)
+			field.VarType = new(types.Invalid)
+		}
+		if field.Value != nil {
+			p.error(diag.ParamInitValue, field.Pos(), field.End(), "%s cannot have initial value", field.Name)
+		}
+		decl.Fields = append(decl.Fields, field)
+		p.consumeComma(token.RBRACE)
+	}
+	p.next()
+	decl.SetEnd(p.end())
+	// the literal of empty struct cannot be told from a block
+	if len(decl.Fields) == 0 {
+		p.error(diag.EmptyStruct, decl.Pos(), decl.End(), "struct %s must have at least one field", decl.Name)
+	}
+	return decl
+}
+
+func (p *parser) parseEnumDecl() *ast.EnumDecl {
+	p.expect(token.IDENT)
+	decl := new(ast.EnumDecl)
+	decl.SetPos(p.tok.Pos)
+	decl.Name = p.tok.Literal
+	decl.Type = &types.Enum{Name: decl.Name}
+	p.next()
+	p.consume(token.LBRACE)
+	for p.tok.Type != token.RBRACE {
+		decl.Variants = append(decl.Variants, p.parseVariantDecl())
+		p.consumeComma(token.RBRACE)
+	}
+	p.next()
+	decl.SetEnd(p.end())
+	return decl
+}
+
+func (p *parser) parseTypeDecl() *ast.TypeDecl {
+	p.expect(token.IDENT)
+	decl := new(ast.TypeDecl)
+	decl.SetPos(p.tok.Pos)
+	decl.Name = p.tok.Literal
+	p.next()
+	if p.tok.Type == token.ASSIGN {
+		p.next()
+		decl.Type = &types.Alias{Name: decl.Name, Type: p.parseType()}
+	} else {
+		decl.Type = &types.Defined{Name: decl.Name, Type: p.parseType()}
+	}
+	decl.SetEnd(p.end())
+	return decl
+}
+
+func (p *parser) parseVariantDecl() *ast.VariantDecl {
+	p.expect(token.IDENT)
+	decl := new(ast.VariantDecl)
+	decl.SetPos(p.tok.Pos)
+	decl.Name = p.tok.Literal
+	p.next()
+	if p.tok.Type == token.LPAREN {
+		p.next()
+		for p.tok.Type != token.RPAREN {
+			decl.Payload = append(decl.Payload, p.parseType())
+			p.consumeComma(token.RPAREN)
+		}
+		p.next()
+	}
+	decl.SetEnd(p.end())
 	return decl
 }
 
@@ -539,6 +1229,12 @@ func (p *parser) parseType() types.Type {
 	case token.INT:
 		p.next()
 		return new(types.Int)
+	case token.FLOAT:
+		p.next()
+		return new(types.Float)
+	case token.CHAR:
+		p.next()
+		return new(types.Char)
 	case token.BOOL:
 		p.next()
 		return new(types.Bool)
@@ -548,26 +1244,45 @@ func (p *parser) parseType() types.Type {
 	case token.RANGE:
 		p.next()
 		return new(types.Range)
+	case token.QUESTION:
+		p.next()
+		return &types.Option{ElemType: p.parseType()}
 	case token.LBRACK:
-		return p.parseArray()
+		return p.parseArrayOrSlice()
 	case token.LPAREN:
-		return p.parseFunc()
+		return p.parseFuncOrTuple()
+	case token.IDENT:
+		typ := &types.Named{Name: p.tok.Literal, Pos: p.tok.Pos, End: p.tok.End}
+		p.next()
+		return typ
 	default:
-		p.error("%s: unexpected %s", p.tok.Pos, p.tok.Type)
+		p.bailout(diag.Syntax, p.tok.Pos, p.tok.End, "unexpected %s", p.tok.Type)
 		return nil // unreachable
 	}
 }
 
-func (p *parser) parseArray() *types.Array {
+func (p *parser) parseArrayOrSlice() types.Type {
 	typ := new(types.Array)
 	p.next()
+	if p.tok.Type == token.RBRACK {
+		p.next()
+		return &types.Slice{ElemType: p.parseType()}
+	}
+	if p.tok.Type == token.IDENT {
+		// length given by the type parameter
+		typ.LenParam = &types.TypeParam{Name: p.tok.Literal}
+		p.next()
+		p.consume(token.RBRACK)
+		typ.ElemType = p.parseType()
+		return typ
+	}
 	p.expect(token.NUMBER)
-	len, err := strconv.Atoi(p.tok.Literal)
+	len, err := parseInt(p.tok.Literal)
 	if err != nil {
-		p.error("%s: cannot parse %s as integer", p.tok.Pos, p.tok.Literal)
+		p.error(diag.InvalidInteger, p.tok.Pos, p.tok.End, "cannot parse %s as integer", p.tok.Literal)
 	}
 	if len < 0 {
-		p.error("%s: array length must be non-negative number", p.tok.Pos)
+		p.error(diag.InvalidArrayLen, p.tok.Pos, p.tok.End, "array length must be non-negative number")
 	}
 	typ.Len = len
 	p.next()
@@ -576,15 +1291,25 @@ func (p *parser) parseArray() *types.Array {
 	return typ
 }
 
-func (p *parser) parseFunc() *types.Func {
-	typ := new(types.Func)
+func (p *parser) parseFuncOrTuple() types.Type {
+	pos := p.tok.Pos
+	var elems []types.Type
 	p.next()
 	for p.tok.Type != token.RPAREN {
-		typ.ParamTypes = append(typ.ParamTypes, p.parseType())
+		elems = append(elems, p.parseType())
 		p.consumeComma(token.RPAREN)
 	}
 	p.next()
-	p.consume(token.ARROW)
+	// Tuple
+	if p.tok.Type != token.ARROW {
+		if len(elems) < 2 {
+			p.bailout(diag.Syntax, pos, p.end(), "tuple must have two or more elements")
+		}
+		return &types.Tuple{ElemTypes: elems}
+	}
+	// Func
+	typ := &types.Func{ParamTypes: elems}
+	p.next()
 	if p.tok.Type == token.VOID {
 		p.next()
 	} else {
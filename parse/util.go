@@ -1,6 +1,11 @@
 package parse
 
-import "github.com/oshima/lang/token"
+import (
+	"strconv"
+	"strings"
+
+	"github.com/oshima/lang/token"
+)
 
 // The oparator precedence
 const (
@@ -31,10 +36,16 @@ var precOf = map[token.Type]int{
 	token.ASTERISK: PRODUCT,
 	token.SLASH:    PRODUCT,
 	token.PERCENT:  PRODUCT,
+	token.PIPE:     SUM,
+	token.CARET:    SUM,
+	token.AMP:      PRODUCT,
+	token.SHL:      PRODUCT,
+	token.SHR:      PRODUCT,
 	token.IN:       IN,
 	token.BETWEEN:  BETWEEN,
 	token.LBRACK:   SUFFIX,
 	token.LPAREN:   SUFFIX,
+	token.DOT:      SUFFIX,
 }
 
 var assignOps = map[token.Type]bool{
@@ -44,15 +55,53 @@ var assignOps = map[token.Type]bool{
 	token.MULASSIGN: true,
 	token.DIVASSIGN: true,
 	token.MODASSIGN: true,
+	token.ANDASSIGN: true,
+	token.ORASSIGN:  true,
+	token.XORASSIGN: true,
+	token.SHLASSIGN: true,
+	token.SHRASSIGN: true,
+}
+
+var stmtBegin = map[token.Type]bool{
+	token.VAR:    true,
+	token.FUNC:   true,
+	token.IF:     true,
+	token.WHILE:  true,
+	token.FOR:    true,
+	token.RETURN: true,
+	token.STRUCT: true,
+	token.ENUM:   true,
+	token.MATCH:  true,
+	token.TYPE:   true,
+}
+
+// the keywords beginning statements, used for suggestions
+var stmtKeywords = map[string]token.Type{
+	"var":      token.VAR,
+	"func":     token.FUNC,
+	"if":       token.IF,
+	"while":    token.WHILE,
+	"for":      token.FOR,
+	"continue": token.CONTINUE,
+	"break":    token.BREAK,
+	"return":   token.RETURN,
+	"struct":   token.STRUCT,
+	"enum":     token.ENUM,
+	"match":    token.MATCH,
+	"type":     token.TYPE,
 }
 
 var typeBegin = map[token.Type]bool{
-	token.INT:    true,
-	token.BOOL:   true,
-	token.STRING: true,
-	token.RANGE:  true,
-	token.LBRACK: true,
-	token.LPAREN: true,
+	token.QUESTION: true,
+	token.INT:      true,
+	token.FLOAT:    true,
+	token.CHAR:     true,
+	token.BOOL:     true,
+	token.STRING:   true,
+	token.RANGE:    true,
+	token.LBRACK:   true,
+	token.LPAREN:   true,
+	token.IDENT:    true,
 }
 
 var unescape = map[rune]rune{
@@ -63,7 +112,10 @@ var unescape = map[rune]rune{
 	'r':  '\r',
 	't':  '\t',
 	'v':  '\v',
+	'0':  0,
 	'"':  '"',
+	'\'': '\'',
+	'$':  '$',
 	'\\': '\\',
 }
 
@@ -71,4 +123,38 @@ var libFuncs = map[string]bool{
 	"puts":   true,
 	"printf": true,
 	"sleep":  true,
+	"len":    true,
+	"cap":    true,
+	"append": true,
+}
+
+// hasBase checks if the number literal begins with the prefix of base, such as 0x.
+func hasBase(lit string) bool {
+	lit = strings.TrimPrefix(lit, "-")
+	return len(lit) > 1 && lit[0] == '0' && strings.ContainsRune("xXbBoO", rune(lit[1]))
+}
+
+// isFloatLit checks if the number literal has the fraction or exponent.
+func isFloatLit(lit string) bool {
+	return !hasBase(lit) && strings.ContainsAny(lit, ".eE")
+}
+
+// parseInt parses the integer literal, which may have the prefix of base
+// and the underscores between digits. The literal with the prefix gives the bits of 64-bit integer,
+// so that the highest bit can be set as in 0xFFFF_FFFF_FFFF_FFFF.
+func parseInt(lit string) (int, error) {
+	if hasBase(lit) && !strings.HasPrefix(lit, "-") {
+		n, err := strconv.ParseUint(lit, 0, 64)
+		return int(n), err
+	}
+	if hasBase(lit) {
+		n, err := strconv.ParseInt(lit, 0, 64)
+		return int(n), err
+	}
+	// leading zeros don't mean octal, unlike strconv.ParseInt with base 0
+	digits := strings.TrimPrefix(lit, "-")
+	if strings.HasSuffix(digits, "_") || strings.Contains(digits, "__") {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.Atoi(strings.Replace(lit, "_", "", -1))
 }
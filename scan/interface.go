@@ -3,8 +3,10 @@ package scan
 import "github.com/oshima/lang/token"
 
 // Scan separetes the source code into lexical tokens.
-func Scan(runes []rune) []*token.Token {
-	s := &scanner{runes: runes, idx: -1, line: 1, col: 0}
+// The tokens are returned even if the source code has errors.
+func Scan(file *token.File) ([]*token.Token, error) {
+	s := &scanner{file: file, src: file.Src, line: 1, col: 0}
 	s.next()
-	return s.readTokens()
+	tokens := s.readTokens()
+	return tokens, s.errors.Err()
 }
@@ -2,18 +2,24 @@ package scan
 
 import (
 	"fmt"
-	"os"
+	"unicode/utf8"
 
+	"github.com/oshima/lang/diag"
 	"github.com/oshima/lang/token"
 )
 
 type scanner struct {
-	runes   []rune       // source code
-	idx     int          // current index
-	ch      rune         // current character (runes[idx])
-	line    int          // current line
-	col     int          // current column
-	lastTok *token.Token // last token scanner has read
+	file    *token.File    // source file
+	src     []byte         // source code
+	offset  int            // current offset
+	width   int            // width of current character in bytes
+	ch      rune           // current character (src[offset:offset+width])
+	line    int            // current line
+	col     int            // current column
+	lastTok *token.Token   // last token scanner has read
+	braces  int            // number of braces opened
+	interps []int          // number of braces opened at the beginning of each interpolation
+	errors  diag.ErrorList // errors scanner has found
 }
 
 func (s *scanner) next() {
@@ -23,17 +29,18 @@ func (s *scanner) next() {
 	} else {
 		s.col++
 	}
-	s.idx++
-	if s.idx < len(s.runes) {
-		s.ch = s.runes[s.idx]
+	s.offset += s.width
+	if s.offset < len(s.src) {
+		s.ch, s.width = utf8.DecodeRune(s.src[s.offset:])
 	} else {
-		s.ch = 0
+		s.ch, s.width = 0, 0
 	}
 }
 
 func (s *scanner) peek() rune {
-	if s.idx+1 < len(s.runes) {
-		return s.runes[s.idx+1]
+	if s.offset+s.width < len(s.src) {
+		ch, _ := utf8.DecodeRune(s.src[s.offset+s.width:])
+		return ch
 	}
 	return 0
 }
@@ -43,11 +50,11 @@ func (s *scanner) consume(ch rune) {
 	case ch:
 		s.next()
 	case '\n':
-		s.error("%s: unexpected newline", s.pos())
+		s.error(diag.UnexpectedChar, s.pos(), s.posAfter(), "unexpected newline")
 	case 0:
-		s.error("%s: unexpected eof", s.pos())
+		s.error(diag.UnexpectedChar, s.pos(), s.posAfter(), "unexpected eof")
 	default:
-		s.error("%s: unexpected %c", s.pos(), s.ch)
+		s.error(diag.UnexpectedChar, s.pos(), s.posAfter(), "unexpected %c", s.ch)
 	}
 }
 
@@ -58,12 +65,24 @@ func (s *scanner) skipWs() {
 }
 
 func (s *scanner) pos() *token.Pos {
-	return &token.Pos{Line: s.line, Col: s.col}
+	return &token.Pos{File: s.file, Offset: s.offset, Line: s.line, Col: s.col}
 }
 
-func (s *scanner) error(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, format+"\n", a...)
-	os.Exit(1)
+// posAfter returns the position following the current character.
+func (s *scanner) posAfter() *token.Pos {
+	pos := s.pos()
+	pos.Offset += s.width
+	if s.ch == '\n' {
+		pos.Line++
+		pos.Col = 1
+	} else if s.width > 0 {
+		pos.Col++
+	}
+	return pos
+}
+
+func (s *scanner) error(code diag.Code, pos *token.Pos, end *token.Pos, format string, a ...interface{}) {
+	s.errors.Add(code, pos, end, fmt.Sprintf(format, a...))
 }
 
 // ----------------------------------------------------------------
@@ -75,14 +94,20 @@ func (s *scanner) readTokens() []*token.Token {
 	for s.ch != 0 {
 		pos := s.pos()
 		tok := s.readToken()
+		if tok == nil {
+			// invalid character
+			s.skipWs()
+			continue
+		}
 		tok.Pos = pos
+		tok.End = s.pos()
 		if tok.Type != token.COMMENT {
 			tokens = append(tokens, tok)
 		}
 		s.lastTok = tok
 		s.skipWs()
 	}
-	eof := &token.Token{Type: token.EOF, Pos: s.pos()}
+	eof := &token.Token{Type: token.EOF, Pos: s.pos(), End: s.pos()}
 	return append(tokens, eof)
 }
 
@@ -90,10 +115,19 @@ func (s *scanner) readToken() *token.Token {
 	switch s.ch {
 	case '#':
 		return s.readComment()
-	case '(', ')', '[', ']', '{', '}', ',', ':', ';':
+	case '(', ')', '[', ']', ',', ':', ';', '?', '~':
+		return s.readPunct()
+	case '{':
+		s.braces++
+		return s.readPunct()
+	case '}':
+		if n := len(s.interps); n > 0 && s.interps[n-1] == s.braces {
+			return s.readQuotedAfterInterp()
+		}
+		s.braces--
 		return s.readPunct()
 	case '=':
-		return s.readAssignOrEqual()
+		return s.readAssignOrEqualOrFatArrow()
 	case '!':
 		return s.readBangOrNotEqual()
 	case '+':
@@ -107,17 +141,23 @@ func (s *scanner) readToken() *token.Token {
 	case '%':
 		return s.readPercentOrModAssign()
 	case '<':
-		return s.readLessOrLessEqual()
+		return s.readLessOrLessEqualOrShl()
 	case '>':
-		return s.readGreaterOrGreaterEqual()
+		return s.readGreaterOrGreaterEqualOrShr()
 	case '&':
-		return s.readAnd()
+		return s.readAmpOrAndAssignOrAnd()
 	case '|':
-		return s.readOr()
+		return s.readPipeOrOrAssignOrOr()
+	case '^':
+		return s.readCaretOrXorAssign()
 	case '.':
-		return s.readBetween()
+		return s.readDotOrBetween()
 	case '"':
 		return s.readQuoted()
+	case '`':
+		return s.readRawQuoted()
+	case '\'':
+		return s.readQuotedChar()
 	default:
 		switch {
 		case isDigit(s.ch):
@@ -125,19 +165,20 @@ func (s *scanner) readToken() *token.Token {
 		case isAlpha(s.ch):
 			return s.readKeywordOrIdentifier()
 		default:
-			s.error("%s: invalid character %c", s.pos(), s.ch)
-			return nil // unreachable
+			s.error(diag.InvalidChar, s.pos(), s.posAfter(), "invalid character %c", s.ch)
+			s.next()
+			return nil
 		}
 	}
 }
 
 func (s *scanner) readComment() *token.Token {
-	idx := s.idx
+	offset := s.offset
 	s.next()
 	for s.ch != '\n' && s.ch != 0 {
 		s.next()
 	}
-	literal := string(s.runes[idx:s.idx])
+	literal := string(s.src[offset:s.offset])
 	return &token.Token{Type: token.COMMENT, Literal: literal}
 }
 
@@ -148,12 +189,16 @@ func (s *scanner) readPunct() *token.Token {
 	return &token.Token{Type: typ, Literal: literal}
 }
 
-func (s *scanner) readAssignOrEqual() *token.Token {
+func (s *scanner) readAssignOrEqualOrFatArrow() *token.Token {
 	s.next()
 	if s.ch == '=' {
 		s.next()
 		return &token.Token{Type: token.EQ, Literal: "=="}
 	}
+	if s.ch == '>' {
+		s.next()
+		return &token.Token{Type: token.FATARROW, Literal: "=>"}
+	}
 	return &token.Token{Type: token.ASSIGN, Literal: "="}
 }
 
@@ -228,79 +273,201 @@ func (s *scanner) readPercentOrModAssign() *token.Token {
 	return &token.Token{Type: token.PERCENT, Literal: "%"}
 }
 
-func (s *scanner) readLessOrLessEqual() *token.Token {
+func (s *scanner) readLessOrLessEqualOrShl() *token.Token {
 	s.next()
 	if s.ch == '=' {
 		s.next()
 		return &token.Token{Type: token.LE, Literal: "<="}
 	}
+	if s.ch == '<' {
+		s.next()
+		if s.ch == '=' {
+			s.next()
+			return &token.Token{Type: token.SHLASSIGN, Literal: "<<="}
+		}
+		return &token.Token{Type: token.SHL, Literal: "<<"}
+	}
 	return &token.Token{Type: token.LT, Literal: "<"}
 }
 
-func (s *scanner) readGreaterOrGreaterEqual() *token.Token {
+func (s *scanner) readGreaterOrGreaterEqualOrShr() *token.Token {
 	s.next()
 	if s.ch == '=' {
 		s.next()
 		return &token.Token{Type: token.GE, Literal: ">="}
 	}
+	if s.ch == '>' {
+		s.next()
+		if s.ch == '=' {
+			s.next()
+			return &token.Token{Type: token.SHRASSIGN, Literal: ">>="}
+		}
+		return &token.Token{Type: token.SHR, Literal: ">>"}
+	}
 	return &token.Token{Type: token.GT, Literal: ">"}
 }
 
-func (s *scanner) readAnd() *token.Token {
+func (s *scanner) readAmpOrAndAssignOrAnd() *token.Token {
+	s.next()
+	if s.ch == '=' {
+		s.next()
+		return &token.Token{Type: token.ANDASSIGN, Literal: "&="}
+	}
+	if s.ch == '&' {
+		s.next()
+		return &token.Token{Type: token.AND, Literal: "&&"}
+	}
+	return &token.Token{Type: token.AMP, Literal: "&"}
+}
+
+func (s *scanner) readPipeOrOrAssignOrOr() *token.Token {
 	s.next()
-	s.consume('&')
-	return &token.Token{Type: token.AND, Literal: "&&"}
+	if s.ch == '=' {
+		s.next()
+		return &token.Token{Type: token.ORASSIGN, Literal: "|="}
+	}
+	if s.ch == '|' {
+		s.next()
+		return &token.Token{Type: token.OR, Literal: "||"}
+	}
+	return &token.Token{Type: token.PIPE, Literal: "|"}
 }
 
-func (s *scanner) readOr() *token.Token {
+func (s *scanner) readCaretOrXorAssign() *token.Token {
 	s.next()
-	s.consume('|')
-	return &token.Token{Type: token.OR, Literal: "||"}
+	if s.ch == '=' {
+		s.next()
+		return &token.Token{Type: token.XORASSIGN, Literal: "^="}
+	}
+	return &token.Token{Type: token.CARET, Literal: "^"}
 }
 
-func (s *scanner) readBetween() *token.Token {
+func (s *scanner) readDotOrBetween() *token.Token {
 	s.next()
-	s.consume('.')
-	return &token.Token{Type: token.BETWEEN, Literal: ".."}
+	if s.ch == '.' {
+		s.next()
+		return &token.Token{Type: token.BETWEEN, Literal: ".."}
+	}
+	return &token.Token{Type: token.DOT, Literal: "."}
 }
 
 func (s *scanner) readQuoted() *token.Token {
-	idx := s.idx
+	return s.readQuotedUntil(token.QUOTED, token.QUOTEDHEAD)
+}
+
+// readRawQuoted reads the characters between backquotes as they are, including newlines.
+func (s *scanner) readRawQuoted() *token.Token {
+	offset := s.offset
+	s.next()
+	for s.ch != '`' {
+		if s.ch == 0 {
+			s.error(diag.UnterminatedString, s.pos(), s.posAfter(), "unexpected eof")
+			return &token.Token{Type: token.QUOTED, Literal: string(s.src[offset:])}
+		}
+		s.next()
+	}
+	s.next()
+	literal := string(s.src[offset:s.offset])
+	return &token.Token{Type: token.QUOTED, Literal: literal}
+}
+
+// readQuotedAfterInterp reads the quoted characters following the closing brace of interpolation.
+func (s *scanner) readQuotedAfterInterp() *token.Token {
+	s.interps = s.interps[:len(s.interps)-1]
+	return s.readQuotedUntil(token.QUOTEDTAIL, token.QUOTEDMID)
+}
+
+// readQuotedUntil reads the quoted characters until the closing quote or the beginning of interpolation,
+// which give the token of typ or interpTyp respectively.
+func (s *scanner) readQuotedUntil(typ token.Type, interpTyp token.Type) *token.Token {
+	offset := s.offset
 	s.next()
 	for s.ch != '"' {
 		if s.ch == '\\' {
 			s.next()
+		} else if s.ch == '$' && s.peek() == '{' {
+			s.next()
+			s.next()
+			s.interps = append(s.interps, s.braces)
+			literal := string(s.src[offset:s.offset])
+			return &token.Token{Type: interpTyp, Literal: literal}
 		}
 		if s.ch == 0 {
-			s.error("%s: unexpected eof", s.pos())
+			s.error(diag.UnterminatedString, s.pos(), s.posAfter(), "unexpected eof")
+			return &token.Token{Type: typ, Literal: string(s.src[offset:])}
 		}
 		s.next()
 	}
 	s.next()
-	literal := string(s.runes[idx:s.idx])
-	return &token.Token{Type: token.QUOTED, Literal: literal}
+	literal := string(s.src[offset:s.offset])
+	return &token.Token{Type: typ, Literal: literal}
+}
+
+func (s *scanner) readQuotedChar() *token.Token {
+	offset := s.offset
+	s.next()
+	for s.ch != '\'' {
+		if s.ch == '\\' {
+			s.next()
+		}
+		if s.ch == '\n' || s.ch == 0 {
+			s.error(diag.UnterminatedString, s.pos(), s.posAfter(), "unterminated character literal")
+			return &token.Token{Type: token.QUOTEDCHAR, Literal: string(s.src[offset:s.offset])}
+		}
+		s.next()
+	}
+	s.next()
+	literal := string(s.src[offset:s.offset])
+	return &token.Token{Type: token.QUOTEDCHAR, Literal: literal}
 }
 
 func (s *scanner) readNumber() *token.Token {
-	idx := s.idx
+	offset := s.offset
 	if s.ch == '-' {
 		s.next()
 	}
+	// prefix of base, followed by the digits of that base
+	if s.ch == '0' && isBase(s.peek()) {
+		s.next()
+		s.next()
+		for isHexDigit(s.ch) || s.ch == '_' {
+			s.next()
+		}
+		literal := string(s.src[offset:s.offset])
+		return &token.Token{Type: token.NUMBER, Literal: literal}
+	}
 	s.next()
-	for isDigit(s.ch) {
+	for isDigit(s.ch) || s.ch == '_' {
 		s.next()
 	}
-	literal := string(s.runes[idx:s.idx])
+	// fraction, which is not confused with .. of range
+	if s.ch == '.' && isDigit(s.peek()) {
+		s.next()
+		for isDigit(s.ch) || s.ch == '_' {
+			s.next()
+		}
+	}
+	// exponent
+	if s.ch == 'e' || s.ch == 'E' {
+		s.next()
+		if s.ch == '+' || s.ch == '-' {
+			s.next()
+		}
+		for isDigit(s.ch) {
+			s.next()
+		}
+	}
+	literal := string(s.src[offset:s.offset])
 	return &token.Token{Type: token.NUMBER, Literal: literal}
 }
 
 func (s *scanner) readKeywordOrIdentifier() *token.Token {
-	idx := s.idx
+	offset := s.offset
 	s.next()
 	for isAlpha(s.ch) || isDigit(s.ch) {
 		s.next()
 	}
-	literal := string(s.runes[idx:s.idx])
+	literal := string(s.src[offset:s.offset])
 	if typ, ok := keywords[literal]; ok {
 		return &token.Token{Type: typ, Literal: literal}
 	}
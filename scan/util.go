@@ -12,6 +12,8 @@ var punctuations = map[rune]token.Type{
 	',': token.COMMA,
 	':': token.COLON,
 	';': token.SEMICOLON,
+	'?': token.QUESTION,
+	'~': token.TILDE,
 }
 
 var keywords = map[string]token.Type{
@@ -25,30 +27,48 @@ var keywords = map[string]token.Type{
 	"continue": token.CONTINUE,
 	"break":    token.BREAK,
 	"return":   token.RETURN,
+	"struct":   token.STRUCT,
+	"enum":     token.ENUM,
+	"match":    token.MATCH,
+	"type":     token.TYPE,
 	"void":     token.VOID,
 	"int":      token.INT,
+	"float":    token.FLOAT,
+	"char":     token.CHAR,
 	"bool":     token.BOOL,
 	"string":   token.STRING,
 	"range":    token.RANGE,
 	"true":     token.TRUE,
 	"false":    token.FALSE,
+	"none":     token.NONE,
 }
 
 var exprEnd = map[token.Type]bool{
-	token.RPAREN: true,
-	token.RBRACK: true,
-	token.RBRACE: true,
-	token.IDENT:  true,
-	token.NUMBER: true,
-	token.TRUE:   true,
-	token.FALSE:  true,
-	token.QUOTED: true,
+	token.RPAREN:     true,
+	token.RBRACK:     true,
+	token.RBRACE:     true,
+	token.IDENT:      true,
+	token.NUMBER:     true,
+	token.TRUE:       true,
+	token.FALSE:      true,
+	token.NONE:       true,
+	token.QUOTED:     true,
+	token.QUOTEDTAIL: true,
+	token.QUOTEDCHAR: true,
 }
 
 func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func isBase(ch rune) bool {
+	return ch == 'x' || ch == 'X' || ch == 'b' || ch == 'B' || ch == 'o' || ch == 'O'
+}
+
 func isAlpha(ch rune) bool {
 	return 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z' || ch == '_'
 }
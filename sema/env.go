@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/oshima/lang/ast"
+	"github.com/oshima/lang/types"
 )
 
 // env represents a scope of names.
@@ -34,3 +35,45 @@ func (e *env) get(name string) (ast.Node, bool) {
 	}
 	return node, ok
 }
+
+// universe returns the outermost scope, where the basic types are declared for conversions.
+// The sized integer types, which are not keywords, are also declared here to be referred by name.
+func universe() *env {
+	e := newEnv(nil)
+	e.set("int", &ast.TypeDecl{Name: "int", Type: new(types.Int)})
+	e.set("float", &ast.TypeDecl{Name: "float", Type: new(types.Float)})
+	e.set("char", &ast.TypeDecl{Name: "char", Type: new(types.Char)})
+	for _, size := range []int{1, 2, 4} {
+		typ := &types.Int{Size: size}
+		e.set(typ.String(), &ast.TypeDecl{Name: typ.String(), Type: typ})
+	}
+	for _, size := range []int{1, 2, 4, 8} {
+		typ := &types.Int{Size: size, Unsigned: true}
+		e.set(typ.String(), &ast.TypeDecl{Name: typ.String(), Type: typ})
+	}
+	e.set("bool", &ast.TypeDecl{Name: "bool", Type: new(types.Bool)})
+	e.set("string", &ast.TypeDecl{Name: "string", Type: new(types.String)})
+	return e
+}
+
+// names returns the names of the variables, functions, types and type parameters visible from the scope.
+// The predeclared types are not included.
+func (e *env) names() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for ; e != nil; e = e.outer {
+		for name, node := range e.store {
+			switch node.(type) {
+			case *ast.VarDecl, *ast.FuncDecl, *ast.StructDecl, *ast.EnumDecl, *ast.TypeDecl, *ast.TypeParamDecl:
+				if node.Pos() == nil {
+					continue
+				}
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
@@ -1,12 +1,27 @@
 package sema
 
-import "github.com/oshima/lang/ast"
+import (
+	"github.com/oshima/lang/ast"
+	"github.com/oshima/lang/diag"
+)
 
 // Analyze checks if the program is correct.
-func Analyze(prog *ast.Program) {
+func Analyze(prog *ast.Program) error {
 	r := &resolver{}
-	r.resolveProgram(prog, newEnv(nil))
+	r.resolveProgram(prog, newEnv(universe()))
 
 	t := &typechecker{}
 	t.typecheckProgram(prog)
+
+	return append(r.errors, t.errors...).Err()
+}
+
+// Lint reports the warnings in the program which has been analyzed without errors.
+// The warnings missing from levels are not reported.
+func Lint(prog *ast.Program, levels map[diag.Code]diag.Severity) diag.ErrorList {
+	l := &linter{levels: levels, used: make(map[ast.Node]bool)}
+	l.lintProgram(prog, newEnv(nil))
+
+	l.warnings.Sort()
+	return l.warnings
 }
@@ -0,0 +1,323 @@
+package sema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oshima/lang/ast"
+	"github.com/oshima/lang/diag"
+	"github.com/oshima/lang/token"
+)
+
+// linter reports the suspicious constructs in the resolved AST.
+type linter struct {
+	levels   map[diag.Code]diag.Severity
+	warnings diag.ErrorList
+	decls    []ast.Node        // VarDecl or FuncDecl which may be unused
+	used     map[ast.Node]bool // referenced VarDecl or FuncDecl
+	fn       ast.Node          // declaration of the function being linted
+}
+
+func (l *linter) warn(code diag.Code, pos *token.Pos, end *token.Pos, format string, a ...interface{}) *diag.Error {
+	level, ok := l.levels[code]
+	if !ok {
+		return nil
+	}
+	w := l.warnings.Add(code, pos, end, fmt.Sprintf(format, a...))
+	w.Severity = level
+	return w
+}
+
+// ----------------------------------------------------------------
+// Program
+
+func (l *linter) lintProgram(prog *ast.Program, e *env) {
+	// register the function, struct and enum names in advance
+	for _, stmt := range prog.Stmts {
+		switch v := stmt.(type) {
+		case *ast.FuncStmt:
+			e.set(v.Func.Name, v.Func)
+		case *ast.StructStmt:
+			e.set(v.Struct.Name, v.Struct)
+		case *ast.EnumStmt:
+			e.set(v.Enum.Name, v.Enum)
+		}
+	}
+	for _, stmt := range prog.Stmts {
+		l.lintStmt(stmt, e)
+	}
+
+	for _, decl := range l.decls {
+		if l.used[decl] {
+			continue
+		}
+		switch v := decl.(type) {
+		case *ast.VarDecl:
+			l.warn(diag.UnusedVar, v.Pos(), v.End(), "%s is declared but not used", v.Name)
+		case *ast.FuncDecl:
+			l.warn(diag.UnusedFunc, v.Pos(), v.End(), "%s is declared but not called", v.Name)
+		}
+	}
+}
+
+// ----------------------------------------------------------------
+// Stmt
+
+func (l *linter) lintStmt(stmt ast.Stmt, e *env) {
+	switch v := stmt.(type) {
+	case *ast.BlockStmt:
+		l.lintBlockStmt(v, newEnv(e))
+	case *ast.VarStmt:
+		l.lintVarStmt(v, e)
+	case *ast.FuncStmt:
+		l.lintFuncStmt(v, e)
+	case *ast.IfStmt:
+		l.lintIfStmt(v, e)
+	case *ast.WhileStmt:
+		l.lintWhileStmt(v, e)
+	case *ast.ForStmt:
+		l.lintForStmt(v, e)
+	case *ast.MatchStmt:
+		l.lintMatchStmt(v, e)
+	case *ast.ReturnStmt:
+		l.lintReturnStmt(v, e)
+	case *ast.AssignStmt:
+		l.lintAssignStmt(v, e)
+	case *ast.ExprStmt:
+		l.lintExprStmt(v, e)
+	}
+}
+
+func (l *linter) lintBlockStmt(stmt *ast.BlockStmt, e *env) {
+	// register the function, struct and enum names in advance
+	for _, stmt := range stmt.Stmts {
+		switch v := stmt.(type) {
+		case *ast.FuncStmt:
+			e.set(v.Func.Name, v.Func)
+		case *ast.StructStmt:
+			e.set(v.Struct.Name, v.Struct)
+		case *ast.EnumStmt:
+			e.set(v.Enum.Name, v.Enum)
+		}
+	}
+
+	var terminator ast.Stmt
+	for _, s := range stmt.Stmts {
+		if terminator != nil {
+			switch s.(type) {
+			case *ast.FuncStmt, *ast.StructStmt, *ast.EnumStmt, *ast.TypeStmt:
+				// declarations are not executed
+			default:
+				last := stmt.Stmts[len(stmt.Stmts)-1]
+				w := l.warn(diag.Unreachable, s.Pos(), last.End(), "unreachable code")
+				if w != nil {
+					w.AddNote(terminator.Pos(), terminator.End(), "any code following this statement is unreachable")
+				}
+				terminator = nil
+			}
+		}
+		switch s.(type) {
+		case *ast.ReturnStmt, *ast.BreakStmt, *ast.ContinueStmt:
+			if terminator == nil {
+				terminator = s
+			}
+		}
+		l.lintStmt(s, e)
+	}
+}
+
+func (l *linter) lintVarStmt(stmt *ast.VarStmt, e *env) {
+	if stmt.Value != nil {
+		l.lintExpr(stmt.Value, e)
+	}
+	for _, v := range stmt.Vars {
+		if e.outer != nil {
+			if prev, ok := e.outer.get(v.Name); ok {
+				w := l.warn(diag.Shadow, v.Pos(), v.End(), "%s shadows the outer declaration", v.Name)
+				if w != nil {
+					w.AddNote(prev.Pos(), prev.End(), "shadowed declaration is here")
+				}
+			}
+		}
+		l.lintVarDecl(v, e)
+		l.declare(v)
+	}
+}
+
+func (l *linter) lintFuncStmt(stmt *ast.FuncStmt, e *env) {
+	l.lintFuncDecl(stmt.Func, e)
+	l.declare(stmt.Func)
+}
+
+func (l *linter) lintIfStmt(stmt *ast.IfStmt, e *env) {
+	ne := newEnv(e)
+	if stmt.Var != nil {
+		l.lintVarDecl(stmt.Var, ne)
+		l.declare(stmt.Var)
+	} else {
+		l.lintExpr(stmt.Cond, e)
+	}
+	l.lintBlockStmt(stmt.Body, ne)
+
+	if stmt.Else != nil {
+		l.lintStmt(stmt.Else, e)
+	}
+}
+
+func (l *linter) lintWhileStmt(stmt *ast.WhileStmt, e *env) {
+	l.lintExpr(stmt.Cond, e)
+	l.lintBlockStmt(stmt.Body, newEnv(e))
+}
+
+func (l *linter) lintForStmt(stmt *ast.ForStmt, e *env) {
+	l.lintExpr(stmt.Iter.Value, e)
+
+	ne := newEnv(e)
+	ne.set(stmt.Elem.Name, stmt.Elem)
+	l.declare(stmt.Elem)
+	if stmt.Index.Name != "" {
+		ne.set(stmt.Index.Name, stmt.Index)
+		l.declare(stmt.Index)
+	}
+
+	l.lintBlockStmt(stmt.Body, ne)
+}
+
+func (l *linter) lintMatchStmt(stmt *ast.MatchStmt, e *env) {
+	l.lintExpr(stmt.Value, e)
+
+	for _, arm := range stmt.Arms {
+		ne := newEnv(e)
+		for _, pat := range arm.Patterns {
+			if v, ok := pat.(*ast.VariantPattern); ok {
+				for _, binding := range v.Bindings {
+					ne.set(binding.Name, binding)
+					l.declare(binding)
+				}
+			}
+		}
+		l.lintBlockStmt(arm.Body, ne)
+	}
+}
+
+func (l *linter) lintReturnStmt(stmt *ast.ReturnStmt, e *env) {
+	if stmt.Value != nil {
+		l.lintExpr(stmt.Value, e)
+	}
+}
+
+func (l *linter) lintAssignStmt(stmt *ast.AssignStmt, e *env) {
+	l.lintExpr(stmt.Target, e)
+	l.lintExpr(stmt.Value, e)
+}
+
+func (l *linter) lintExprStmt(stmt *ast.ExprStmt, e *env) {
+	l.lintExpr(stmt.Expr, e)
+}
+
+// ----------------------------------------------------------------
+// Expr
+
+func (l *linter) lintExpr(expr ast.Expr, e *env) {
+	switch v := expr.(type) {
+	case *ast.PrefixExpr:
+		l.lintExpr(v.Right, e)
+	case *ast.InfixExpr:
+		l.lintExpr(v.Left, e)
+		l.lintExpr(v.Right, e)
+	case *ast.IndexExpr:
+		l.lintExpr(v.Left, e)
+		l.lintExpr(v.Index, e)
+	case *ast.FieldExpr:
+		l.lintExpr(v.Left, e)
+	case *ast.SomeExpr:
+		l.lintExpr(v.Value, e)
+	case *ast.CallExpr:
+		l.lintExpr(v.Left, e)
+		for _, param := range v.Params {
+			l.lintExpr(param, e)
+		}
+	case *ast.LibCallExpr:
+		for _, param := range v.Params {
+			l.lintExpr(param, e)
+		}
+	case *ast.Ident:
+		l.lintIdent(v, e)
+	case *ast.StructLit:
+		for _, field := range v.Fields {
+			l.lintExpr(field.Value, e)
+		}
+	case *ast.RangeLit:
+		l.lintExpr(v.Lower, e)
+		l.lintExpr(v.Upper, e)
+	case *ast.ArrayLit:
+		for _, elem := range v.Elems {
+			l.lintExpr(elem, e)
+		}
+	case *ast.ArrayShortLit:
+		l.lintExpr(v.Value, e)
+	case *ast.SliceLit:
+		l.lintExpr(v.Value, e)
+	case *ast.TupleLit:
+		for _, elem := range v.Elems {
+			l.lintExpr(elem, e)
+		}
+	case *ast.FuncLit:
+		l.lintFuncLit(v, e)
+	}
+}
+
+func (l *linter) lintIdent(expr *ast.Ident, e *env) {
+	// recursive calls do not count as uses
+	if expr.Ref != nil && expr.Ref != l.fn {
+		l.used[expr.Ref] = true
+	}
+}
+
+func (l *linter) lintFuncLit(expr *ast.FuncLit, e *env) {
+	ne := newEnv(e)
+	for _, param := range expr.Params {
+		ne.set(param.Name, param)
+	}
+	l.lintBlockStmt(expr.Body, ne)
+}
+
+// ----------------------------------------------------------------
+// Decl
+
+func (l *linter) declare(node ast.Node) {
+	var name string
+	switch v := node.(type) {
+	case *ast.VarDecl:
+		name = v.Name
+	case *ast.FuncDecl:
+		name = v.Name
+	}
+	// names beginning with _ are intentionally unused
+	if !strings.HasPrefix(name, "_") {
+		l.decls = append(l.decls, node)
+	}
+}
+
+func (l *linter) lintVarDecl(decl *ast.VarDecl, e *env) {
+	if v, ok := decl.Value.(*ast.FuncLit); ok {
+		fn := l.fn
+		l.fn = decl
+		l.lintFuncLit(v, e)
+		l.fn = fn
+	} else if decl.Value != nil {
+		l.lintExpr(decl.Value, e)
+	}
+	e.set(decl.Name, decl)
+}
+
+func (l *linter) lintFuncDecl(decl *ast.FuncDecl, e *env) {
+	ne := newEnv(e)
+	for _, param := range decl.Params {
+		ne.set(param.Name, param)
+	}
+
+	l.fn = decl
+	l.lintBlockStmt(decl.Body, ne)
+	l.fn = nil
+}
@@ -2,29 +2,46 @@ package sema
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/oshima/lang/ast"
+	"github.com/oshima/lang/diag"
+	"github.com/oshima/lang/token"
+	"github.com/oshima/lang/types"
 )
 
 // resolver resolves the references between the AST nodes.
-type resolver struct{}
+type resolver struct {
+	errors diag.ErrorList
+}
+
+func (r *resolver) error(code diag.Code, node ast.Node, format string, a ...interface{}) *diag.Error {
+	return r.errors.Add(code, node.Pos(), node.End(), fmt.Sprintf(format, a...))
+}
 
-func (r *resolver) error(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, format+"\n", a...)
-	os.Exit(1)
+// declare registers the name in the current scope.
+func (r *resolver) declare(name string, node ast.Node, e *env) {
+	if err := e.set(name, node); err != nil {
+		prev := e.store[name]
+		d := r.error(diag.Redeclared, node, "%s has already been declared", name)
+		d.AddNote(prev.Pos(), prev.End(), "previously declared here")
+	}
 }
 
 // ----------------------------------------------------------------
 // Program
 
 func (r *resolver) resolveProgram(prog *ast.Program, e *env) {
-	// register the function names in advance
+	// register the function and type names in advance
 	for _, stmt := range prog.Stmts {
-		if v, ok := stmt.(*ast.FuncStmt); ok {
-			if err := e.set(v.Func.Name, v.Func); err != nil {
-				r.error("%s: %s has already been declared", v.Func.Pos(), v.Func.Name)
-			}
+		switch v := stmt.(type) {
+		case *ast.FuncStmt:
+			r.declare(v.Func.Name, v.Func, e)
+		case *ast.StructStmt:
+			r.declare(v.Struct.Name, v.Struct, e)
+		case *ast.EnumStmt:
+			r.declare(v.Enum.Name, v.Enum, e)
+		case *ast.TypeStmt:
+			r.declare(v.Type.Name, v.Type, e)
 		}
 	}
 	for _, stmt := range prog.Stmts {
@@ -43,12 +60,20 @@ func (r *resolver) resolveStmt(stmt ast.Stmt, e *env) {
 		r.resolveVarStmt(v, e)
 	case *ast.FuncStmt:
 		r.resolveFuncStmt(v, e)
+	case *ast.StructStmt:
+		r.resolveStructStmt(v, e)
+	case *ast.EnumStmt:
+		r.resolveEnumStmt(v, e)
+	case *ast.TypeStmt:
+		r.resolveTypeStmt(v, e)
 	case *ast.IfStmt:
 		r.resolveIfStmt(v, e)
 	case *ast.WhileStmt:
 		r.resolveWhileStmt(v, e)
 	case *ast.ForStmt:
 		r.resolveForStmt(v, e)
+	case *ast.MatchStmt:
+		r.resolveMatchStmt(v, e)
 	case *ast.ContinueStmt:
 		r.resolveContinueStmt(v, e)
 	case *ast.BreakStmt:
@@ -63,12 +88,17 @@ func (r *resolver) resolveStmt(stmt ast.Stmt, e *env) {
 }
 
 func (r *resolver) resolveBlockStmt(stmt *ast.BlockStmt, e *env) {
-	// register the function names in advance
+	// register the function and type names in advance
 	for _, stmt := range stmt.Stmts {
-		if v, ok := stmt.(*ast.FuncStmt); ok {
-			if err := e.set(v.Func.Name, v.Func); err != nil {
-				r.error("%s: %s has already been declared", v.Func.Pos(), v.Func.Name)
-			}
+		switch v := stmt.(type) {
+		case *ast.FuncStmt:
+			r.declare(v.Func.Name, v.Func, e)
+		case *ast.StructStmt:
+			r.declare(v.Struct.Name, v.Struct, e)
+		case *ast.EnumStmt:
+			r.declare(v.Enum.Name, v.Enum, e)
+		case *ast.TypeStmt:
+			r.declare(v.Type.Name, v.Type, e)
 		}
 	}
 	for _, stmt := range stmt.Stmts {
@@ -77,6 +107,9 @@ func (r *resolver) resolveBlockStmt(stmt *ast.BlockStmt, e *env) {
 }
 
 func (r *resolver) resolveVarStmt(stmt *ast.VarStmt, e *env) {
+	if stmt.Value != nil {
+		r.resolveExpr(stmt.Value, e)
+	}
 	for _, v := range stmt.Vars {
 		r.resolveVarDecl(v, e)
 	}
@@ -86,9 +119,26 @@ func (r *resolver) resolveFuncStmt(stmt *ast.FuncStmt, e *env) {
 	r.resolveFuncDecl(stmt.Func, e)
 }
 
+func (r *resolver) resolveStructStmt(stmt *ast.StructStmt, e *env) {
+	r.resolveStructDecl(stmt.Struct, e)
+}
+
+func (r *resolver) resolveEnumStmt(stmt *ast.EnumStmt, e *env) {
+	r.resolveEnumDecl(stmt.Enum, e)
+}
+
+func (r *resolver) resolveTypeStmt(stmt *ast.TypeStmt, e *env) {
+	r.resolveTypeDecl(stmt.Type, e)
+}
+
 func (r *resolver) resolveIfStmt(stmt *ast.IfStmt, e *env) {
-	r.resolveExpr(stmt.Cond, e)
-	r.resolveBlockStmt(stmt.Body, newEnv(e))
+	ne := newEnv(e)
+	if stmt.Var != nil {
+		r.resolveVarDecl(stmt.Var, ne)
+	} else {
+		r.resolveExpr(stmt.Cond, e)
+	}
+	r.resolveBlockStmt(stmt.Body, ne)
 
 	if stmt.Else != nil {
 		r.resolveStmt(stmt.Else, e)
@@ -120,10 +170,22 @@ func (r *resolver) resolveForStmt(stmt *ast.ForStmt, e *env) {
 	r.resolveBlockStmt(stmt.Body, ne)
 }
 
+func (r *resolver) resolveMatchStmt(stmt *ast.MatchStmt, e *env) {
+	r.resolveExpr(stmt.Value, e)
+
+	for _, arm := range stmt.Arms {
+		ne := newEnv(e)
+		for _, pat := range arm.Patterns {
+			r.resolvePattern(pat, ne)
+		}
+		r.resolveBlockStmt(arm.Body, ne)
+	}
+}
+
 func (r *resolver) resolveContinueStmt(stmt *ast.ContinueStmt, e *env) {
 	ref, ok := e.get("continue")
 	if !ok {
-		r.error("%s: illegal use of continue", stmt.Pos())
+		r.error(diag.IllegalBranch, stmt, "illegal use of continue")
 	}
 	stmt.Ref = ref
 }
@@ -131,7 +193,7 @@ func (r *resolver) resolveContinueStmt(stmt *ast.ContinueStmt, e *env) {
 func (r *resolver) resolveBreakStmt(stmt *ast.BreakStmt, e *env) {
 	ref, ok := e.get("break")
 	if !ok {
-		r.error("%s: illegal use of break", stmt.Pos())
+		r.error(diag.IllegalBranch, stmt, "illegal use of break")
 	}
 	stmt.Ref = ref
 }
@@ -143,16 +205,22 @@ func (r *resolver) resolveReturnStmt(stmt *ast.ReturnStmt, e *env) {
 
 	ref, ok := e.get("return")
 	if !ok {
-		r.error("%s: illegal use of return", stmt.Pos())
+		r.error(diag.IllegalBranch, stmt, "illegal use of return")
 	}
 	stmt.Ref = ref
 }
 
 func (r *resolver) resolveAssignStmt(stmt *ast.AssignStmt, e *env) {
 	r.resolveExpr(stmt.Target, e)
-	if v, ok := stmt.Target.(*ast.Ident); ok {
-		if _, ok := v.Ref.(*ast.FuncDecl); ok {
-			r.error("%s: %s is not a variable", v.Pos(), v.Name)
+	targets := []ast.Expr{stmt.Target}
+	if v, ok := stmt.Target.(*ast.TupleLit); ok {
+		targets = v.Elems
+	}
+	for _, target := range targets {
+		if v, ok := target.(*ast.Ident); ok {
+			if _, ok := v.Ref.(*ast.FuncDecl); ok {
+				r.error(diag.NotVariable, v, "%s is not a variable", v.Name)
+			}
 		}
 	}
 	r.resolveExpr(stmt.Value, e)
@@ -173,18 +241,26 @@ func (r *resolver) resolveExpr(expr ast.Expr, e *env) {
 		r.resolveInfixExpr(v, e)
 	case *ast.IndexExpr:
 		r.resolveIndexExpr(v, e)
+	case *ast.FieldExpr:
+		r.resolveFieldExpr(v, e)
 	case *ast.CallExpr:
 		r.resolveCallExpr(v, e)
 	case *ast.LibCallExpr:
 		r.resolveLibCallExpr(v, e)
 	case *ast.Ident:
 		r.resolveIdent(v, e)
+	case *ast.StructLit:
+		r.resolveStructLit(v, e)
 	case *ast.RangeLit:
 		r.resolveRangeLit(v, e)
 	case *ast.ArrayLit:
 		r.resolveArrayLit(v, e)
 	case *ast.ArrayShortLit:
 		r.resolveArrayShortLit(v, e)
+	case *ast.SliceLit:
+		r.resolveSliceLit(v, e)
+	case *ast.TupleLit:
+		r.resolveTupleLit(v, e)
 	case *ast.FuncLit:
 		r.resolveFuncLit(v, e)
 	}
@@ -204,8 +280,32 @@ func (r *resolver) resolveIndexExpr(expr *ast.IndexExpr, e *env) {
 	r.resolveExpr(expr.Index, e)
 }
 
-func (r *resolver) resolveCallExpr(expr *ast.CallExpr, e *env) {
+func (r *resolver) resolveFieldExpr(expr *ast.FieldExpr, e *env) {
+	// variant of enum
+	if v, ok := expr.Left.(*ast.Ident); ok {
+		if ref, ok := e.get(v.Name); ok {
+			if _, ok := ref.(*ast.EnumDecl); ok {
+				v.Ref = ref
+				return
+			}
+		}
+	}
 	r.resolveExpr(expr.Left, e)
+}
+
+func (r *resolver) resolveCallExpr(expr *ast.CallExpr, e *env) {
+	conv := false
+	if v, ok := expr.Left.(*ast.Ident); ok {
+		if ref, ok := e.get(v.Name); ok {
+			if _, ok := ref.(*ast.TypeDecl); ok {
+				v.Ref = ref // conversion to the type
+				conv = true
+			}
+		}
+	}
+	if !conv {
+		r.resolveExpr(expr.Left, e)
+	}
 	for _, param := range expr.Params {
 		r.resolveExpr(param, e)
 	}
@@ -220,11 +320,31 @@ func (r *resolver) resolveLibCallExpr(expr *ast.LibCallExpr, e *env) {
 func (r *resolver) resolveIdent(expr *ast.Ident, e *env) {
 	ref, ok := e.get(expr.Name)
 	if !ok {
-		r.error("%s: %s is not declared", expr.Pos(), expr.Name)
+		r.undeclared(expr.Name, expr.Pos(), expr.End(), e)
+	}
+	switch ref.(type) {
+	case *ast.StructDecl, *ast.EnumDecl, *ast.TypeDecl, *ast.TypeParamDecl:
+		r.error(diag.NotValue, expr, "%s is a type, not a value", expr.Name)
+		ref = nil
 	}
 	expr.Ref = ref
 }
 
+func (r *resolver) resolveStructLit(expr *ast.StructLit, e *env) {
+	ref, ok := e.get(expr.Name)
+	if !ok {
+		r.undeclared(expr.Name, expr.Pos(), expr.End(), e)
+	} else if _, ok := ref.(*ast.StructDecl); !ok {
+		r.error(diag.NotType, expr, "%s is not a struct", expr.Name)
+		ref = nil
+	}
+	expr.Ref = ref
+
+	for _, field := range expr.Fields {
+		r.resolveExpr(field.Value, e)
+	}
+}
+
 func (r *resolver) resolveRangeLit(expr *ast.RangeLit, e *env) {
 	r.resolveExpr(expr.Lower, e)
 	r.resolveExpr(expr.Upper, e)
@@ -237,15 +357,30 @@ func (r *resolver) resolveArrayLit(expr *ast.ArrayLit, e *env) {
 }
 
 func (r *resolver) resolveArrayShortLit(expr *ast.ArrayShortLit, e *env) {
+	expr.ElemType = r.resolveType(expr.ElemType, expr, e)
+	r.resolveExpr(expr.Value, e)
+}
+
+func (r *resolver) resolveSliceLit(expr *ast.SliceLit, e *env) {
+	expr.ElemType = r.resolveType(expr.ElemType, expr, e)
 	r.resolveExpr(expr.Value, e)
 }
 
+func (r *resolver) resolveTupleLit(expr *ast.TupleLit, e *env) {
+	for _, elem := range expr.Elems {
+		r.resolveExpr(elem, e)
+	}
+}
+
 func (r *resolver) resolveFuncLit(expr *ast.FuncLit, e *env) {
 	if _, ok := e.get("return"); ok {
-		r.error("%s: functions cannot be nested", expr.Pos())
+		r.error(diag.NestedFunc, expr, "functions cannot be nested")
 	}
 	if expr.ReturnType != nil && !ast.Returnable(expr.Body) {
-		r.error("%s: missing return at end of function", expr.Body.Pos())
+		r.error(diag.MissingReturn, expr.Body, "missing return at end of function")
+	}
+	if expr.ReturnType != nil {
+		expr.ReturnType = r.resolveType(expr.ReturnType, expr, e)
 	}
 
 	ne := newEnv(e)
@@ -257,10 +392,31 @@ func (r *resolver) resolveFuncLit(expr *ast.FuncLit, e *env) {
 	r.resolveBlockStmt(expr.Body, ne)
 }
 
+// ----------------------------------------------------------------
+// Pattern
+
+func (r *resolver) resolvePattern(pat ast.Expr, e *env) {
+	switch v := pat.(type) {
+	case *ast.VariantPattern:
+		for _, binding := range v.Bindings {
+			// _ discards the value
+			if binding.Name != "_" {
+				r.declare(binding.Name, binding, e)
+			}
+		}
+	default:
+		r.resolveExpr(v, e)
+	}
+}
+
 // ----------------------------------------------------------------
 // Decl
 
 func (r *resolver) resolveVarDecl(decl *ast.VarDecl, e *env) {
+	if decl.VarType != nil {
+		decl.VarType = r.resolveType(decl.VarType, decl, e)
+	}
+
 	switch v := decl.Value.(type) {
 	case nil:
 		// ok
@@ -272,24 +428,214 @@ func (r *resolver) resolveVarDecl(decl *ast.VarDecl, e *env) {
 		r.resolveExpr(v, e)
 	}
 
-	if err := e.set(decl.Name, decl); err != nil {
-		r.error("%s: %s has already been declared", decl.Pos(), decl.Name)
-	}
+	r.declare(decl.Name, decl, e)
 }
 
 func (r *resolver) resolveFuncDecl(decl *ast.FuncDecl, e *env) {
 	if _, ok := e.get("return"); ok {
-		r.error("%s: functions cannot be nested", decl.Pos())
+		r.error(diag.NestedFunc, decl, "functions cannot be nested")
 	}
 	if decl.ReturnType != nil && !ast.Returnable(decl.Body) {
-		r.error("%s: missing return at end of function", decl.Body.Pos())
+		r.error(diag.MissingReturn, decl.Body, "missing return at end of function")
 	}
 
 	ne := newEnv(e)
 	ne.set("return", decl)
 
+	for _, param := range decl.TypeParams {
+		r.declare(param.Name, param, ne)
+	}
+	if decl.ReturnType != nil {
+		decl.ReturnType = r.resolveType(decl.ReturnType, decl, ne)
+	}
 	for _, param := range decl.Params {
 		r.resolveVarDecl(param, ne)
 	}
 	r.resolveBlockStmt(decl.Body, ne)
 }
+
+func (r *resolver) resolveStructDecl(decl *ast.StructDecl, e *env) {
+	fe := newEnv(nil)
+	for _, field := range decl.Fields {
+		field.VarType = r.resolveType(field.VarType, field, e)
+		if generic(field.VarType) {
+			r.error(diag.NotType, field, "type parameters cannot be used in struct")
+			field.VarType = new(types.Invalid)
+		}
+		r.declare(field.Name, field, fe)
+		decl.Type.Fields = append(decl.Type.Fields, &types.Field{Name: field.Name, Type: field.VarType})
+	}
+}
+
+func (r *resolver) resolveEnumDecl(decl *ast.EnumDecl, e *env) {
+	ve := newEnv(nil)
+	for _, variant := range decl.Variants {
+		for i, typ := range variant.Payload {
+			variant.Payload[i] = r.resolveType(typ, variant, e)
+			if generic(variant.Payload[i]) {
+				r.error(diag.NotType, variant, "type parameters cannot be used in enum")
+				variant.Payload[i] = new(types.Invalid)
+			}
+		}
+		r.declare(variant.Name, variant, ve)
+		decl.Type.Variants = append(decl.Type.Variants, &types.Variant{Name: variant.Name, Payload: variant.Payload})
+	}
+}
+
+func (r *resolver) resolveTypeDecl(decl *ast.TypeDecl, e *env) {
+	var typ *types.Type
+	switch v := decl.Type.(type) {
+	case *types.Alias:
+		typ = &v.Type
+	case *types.Defined:
+		typ = &v.Type
+	}
+	*typ = r.resolveType(*typ, decl, e)
+	if generic(*typ) {
+		r.error(diag.NotType, decl, "type parameters cannot be used in type")
+		*typ = new(types.Invalid)
+	}
+	if cyclic(*typ, decl.Type) {
+		r.error(diag.RecursiveType, decl, "invalid recursive type %s", decl.Name)
+		*typ = new(types.Invalid)
+	}
+}
+
+// ----------------------------------------------------------------
+// Type
+
+// resolveType replaces the named types in the type with the declared ones.
+func (r *resolver) resolveType(typ types.Type, node ast.Node, e *env) types.Type {
+	switch v := typ.(type) {
+	case *types.Named:
+		pos, end := v.Pos, v.End
+		if pos == nil {
+			pos, end = node.Pos(), node.End()
+		}
+		ref, ok := e.get(v.Name)
+		if !ok {
+			r.undeclared(v.Name, pos, end, e)
+			return new(types.Invalid)
+		}
+		switch decl := ref.(type) {
+		case *ast.StructDecl:
+			return decl.Type
+		case *ast.EnumDecl:
+			return decl.Type
+		case *ast.TypeDecl:
+			return decl.Type
+		case *ast.TypeParamDecl:
+			return decl.Type
+		default:
+			r.errors.Add(diag.NotType, pos, end, fmt.Sprintf("%s is not a type", v.Name))
+			return new(types.Invalid)
+		}
+	case *types.Array:
+		if v.LenParam != nil {
+			ref, ok := e.get(v.LenParam.Name)
+			if !ok {
+				r.undeclared(v.LenParam.Name, node.Pos(), node.End(), e)
+				return new(types.Invalid)
+			}
+			decl, ok := ref.(*ast.TypeParamDecl)
+			if !ok {
+				r.error(diag.NotType, node, "%s is not a type parameter", v.LenParam.Name)
+				return new(types.Invalid)
+			}
+			v.LenParam = decl.Type
+		}
+		v.ElemType = r.resolveType(v.ElemType, node, e)
+	case *types.Slice:
+		v.ElemType = r.resolveType(v.ElemType, node, e)
+	case *types.Option:
+		v.ElemType = r.resolveType(v.ElemType, node, e)
+	case *types.Tuple:
+		for i, typ := range v.ElemTypes {
+			v.ElemTypes[i] = r.resolveType(typ, node, e)
+		}
+	case *types.Func:
+		for i, typ := range v.ParamTypes {
+			v.ParamTypes[i] = r.resolveType(typ, node, e)
+		}
+		if v.ReturnType != nil {
+			v.ReturnType = r.resolveType(v.ReturnType, node, e)
+		}
+	}
+	return typ
+}
+
+// undeclared reports the undeclared name with the similar names in the scope.
+func (r *resolver) undeclared(name string, pos *token.Pos, end *token.Pos, e *env) {
+	d := r.errors.Add(diag.Undeclared, pos, end, fmt.Sprintf("%s is not declared", name))
+	for _, cand := range diag.Suggest(name, e.names()) {
+		ref, _ := e.get(cand)
+		d.AddNote(ref.Pos(), ref.End(), fmt.Sprintf("did you mean %s?", cand))
+	}
+}
+
+// generic checks if the type contains type parameters.
+func generic(typ types.Type) bool {
+	switch v := typ.(type) {
+	case *types.TypeParam:
+		return true
+	case *types.Array:
+		return v.LenParam != nil || generic(v.ElemType)
+	case *types.Slice:
+		return generic(v.ElemType)
+	case *types.Option:
+		return generic(v.ElemType)
+	case *types.Tuple:
+		for _, typ := range v.ElemTypes {
+			if generic(typ) {
+				return true
+			}
+		}
+	case *types.Func:
+		for _, typ := range v.ParamTypes {
+			if generic(typ) {
+				return true
+			}
+		}
+		return generic(v.ReturnType)
+	}
+	return false
+}
+
+// cyclic checks if the type refers to the target through the aliases and the defined types.
+// The references through struct and enum types are checked by the typechecker.
+func cyclic(typ types.Type, target types.Type) bool {
+	_, named := target.(*types.Defined)
+	return refers(typ, target, named, false)
+}
+
+// refers walks the type for cyclic, where named and indirect tell if a defined type and a slice
+// have been passed respectively. The cycles passing both are allowed like []T in T,
+// since the defined type names the cycle and the slice holds its elements on the heap.
+func refers(typ types.Type, target types.Type, named bool, indirect bool) bool {
+	switch v := typ.(type) {
+	case *types.Alias:
+		return v == target || refers(v.Type, target, named, indirect)
+	case *types.Defined:
+		return v == target || !indirect && refers(v.Type, target, true, indirect)
+	case *types.Array:
+		return refers(v.ElemType, target, named, indirect)
+	case *types.Slice:
+		return !named && refers(v.ElemType, target, named, true)
+	case *types.Option:
+		return refers(v.ElemType, target, named, indirect)
+	case *types.Tuple:
+		for _, typ := range v.ElemTypes {
+			if refers(typ, target, named, indirect) {
+				return true
+			}
+		}
+	case *types.Func:
+		for _, typ := range v.ParamTypes {
+			if refers(typ, target, named, indirect) {
+				return true
+			}
+		}
+		return refers(v.ReturnType, target, named, indirect)
+	}
+	return false
+}
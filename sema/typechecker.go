@@ -2,19 +2,60 @@ package sema
 
 import (
 	"fmt"
-	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/oshima/lang/ast"
+	"github.com/oshima/lang/diag"
 	"github.com/oshima/lang/token"
 	"github.com/oshima/lang/types"
 )
 
 // typechecker performs type checking.
-type typechecker struct{}
+type typechecker struct {
+	errors    diag.ErrorList
+	instances map[*ast.FuncDecl][]*instance
+	inst      *instance // instance being checked
+	depth     int       // depth of nested instantiations
+}
+
+// instance represents an instance of generic function with the type arguments.
+type instance struct {
+	decl *ast.FuncDecl
+	args map[*types.TypeParam]types.Type
+	lens map[*types.TypeParam]int
+	site ast.Node // where the instance is made first
+}
 
-func (t *typechecker) error(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, format+"\n", a...)
-	os.Exit(1)
+func (i *instance) String() string {
+	var args []string
+	for _, param := range i.decl.TypeParams {
+		if typ, ok := i.args[param.Type]; ok {
+			args = append(args, typ.String())
+		} else {
+			args = append(args, strconv.Itoa(i.lens[param.Type]))
+		}
+	}
+	return fmt.Sprintf("%s[%s]", i.decl.Name, strings.Join(args, ", "))
+}
+
+func (t *typechecker) error(code diag.Code, node ast.Node, format string, a ...interface{}) {
+	for _, arg := range a {
+		if _, ok := arg.(*types.Invalid); ok {
+			return // caused by another error which has already been reported
+		}
+	}
+	msg := fmt.Sprintf(format, a...)
+	for _, err := range t.errors {
+		if err.Pos == node.Pos() && err.Msg == msg {
+			return // found again in another instance
+		}
+	}
+	err := t.errors.Add(code, node.Pos(), node.End(), msg)
+	if t.inst != nil {
+		err.AddNote(t.inst.site.Pos(), t.inst.site.End(), fmt.Sprintf("in %s instantiated here", t.inst))
+	}
 }
 
 // ----------------------------------------------------------------
@@ -37,12 +78,18 @@ func (t *typechecker) typecheckStmt(stmt ast.Stmt) {
 		t.typecheckVarStmt(v)
 	case *ast.FuncStmt:
 		t.typecheckFuncStmt(v)
+	case *ast.StructStmt:
+		t.typecheckStructStmt(v)
+	case *ast.EnumStmt:
+		t.typecheckEnumStmt(v)
 	case *ast.IfStmt:
 		t.typecheckIfStmt(v)
 	case *ast.WhileStmt:
 		t.typecheckWhileStmt(v)
 	case *ast.ForStmt:
 		t.typecheckForStmt(v)
+	case *ast.MatchStmt:
+		t.typecheckMatchStmt(v)
 	case *ast.ReturnStmt:
 		t.typecheckReturnStmt(v)
 	case *ast.AssignStmt:
@@ -59,8 +106,30 @@ func (t *typechecker) typecheckBlockStmt(stmt *ast.BlockStmt) {
 }
 
 func (t *typechecker) typecheckVarStmt(stmt *ast.VarStmt) {
-	for _, v := range stmt.Vars {
-		t.typecheckVarDecl(v)
+	if stmt.Value == nil {
+		for _, v := range stmt.Vars {
+			t.typecheckVarDecl(v)
+		}
+		return
+	}
+
+	// destructuring
+	t.typecheckExpr(stmt.Value)
+
+	tuple, ok := types.Underlying(stmt.Value.Type()).(*types.Tuple)
+	if !ok || len(tuple.ElemTypes) != len(stmt.Vars) {
+		if stmt.Value.Type() == nil {
+			t.error(diag.VoidValue, stmt.Value, "unexpected void value")
+		} else {
+			t.error(diag.ValueCount, stmt.Value, "expected %d values, but got %s", len(stmt.Vars), stmt.Value.Type())
+		}
+		for _, v := range stmt.Vars {
+			v.VarType = new(types.Invalid)
+		}
+		return
+	}
+	for i, v := range stmt.Vars {
+		v.VarType = tuple.ElemTypes[i]
 	}
 }
 
@@ -68,11 +137,23 @@ func (t *typechecker) typecheckFuncStmt(stmt *ast.FuncStmt) {
 	t.typecheckFuncDecl(stmt.Func)
 }
 
+func (t *typechecker) typecheckStructStmt(stmt *ast.StructStmt) {
+	t.typecheckStructDecl(stmt.Struct)
+}
+
+func (t *typechecker) typecheckEnumStmt(stmt *ast.EnumStmt) {
+	t.typecheckEnumDecl(stmt.Enum)
+}
+
 func (t *typechecker) typecheckIfStmt(stmt *ast.IfStmt) {
-	t.typecheckExpr(stmt.Cond)
+	if stmt.Var != nil {
+		t.typecheckIfVar(stmt.Var)
+	} else {
+		t.typecheckExpr(stmt.Cond)
 
-	if _, ok := stmt.Cond.Type().(*types.Bool); !ok {
-		t.error("%s: expected bool condition, but got %s", stmt.Cond.Pos(), stmt.Cond.Type())
+		if _, ok := types.Underlying(stmt.Cond.Type()).(*types.Bool); !ok {
+			t.error(diag.TypeMismatch, stmt.Cond, "expected bool condition, but got %s", stmt.Cond.Type())
+		}
 	}
 
 	t.typecheckBlockStmt(stmt.Body)
@@ -82,11 +163,28 @@ func (t *typechecker) typecheckIfStmt(stmt *ast.IfStmt) {
 	}
 }
 
+// typecheckIfVar gives the variable the type of the content of option.
+func (t *typechecker) typecheckIfVar(decl *ast.VarDecl) {
+	t.typecheckExpr(decl.Value)
+
+	opt, ok := types.Underlying(decl.Value.Type()).(*types.Option)
+	if !ok || opt.ElemType == nil {
+		if decl.Value.Type() == nil {
+			t.error(diag.VoidValue, decl.Value, "unexpected void value")
+		} else {
+			t.error(diag.TypeMismatch, decl.Value, "expected option, but got %s", decl.Value.Type())
+		}
+		decl.VarType = new(types.Invalid)
+		return
+	}
+	decl.VarType = opt.ElemType
+}
+
 func (t *typechecker) typecheckWhileStmt(stmt *ast.WhileStmt) {
 	t.typecheckExpr(stmt.Cond)
 
-	if _, ok := stmt.Cond.Type().(*types.Bool); !ok {
-		t.error("%s: expected bool condition, but got %s", stmt.Cond.Pos(), stmt.Cond.Type())
+	if _, ok := types.Underlying(stmt.Cond.Type()).(*types.Bool); !ok {
+		t.error(diag.TypeMismatch, stmt.Cond, "expected bool condition, but got %s", stmt.Cond.Type())
 	}
 
 	t.typecheckBlockStmt(stmt.Body)
@@ -95,19 +193,70 @@ func (t *typechecker) typecheckWhileStmt(stmt *ast.WhileStmt) {
 func (t *typechecker) typecheckForStmt(stmt *ast.ForStmt) {
 	t.typecheckVarDecl(stmt.Iter)
 
-	switch v := stmt.Iter.VarType.(type) {
+	switch v := types.Underlying(stmt.Iter.VarType).(type) {
 	case *types.Range:
 		stmt.Elem.VarType = new(types.Int)
 	case *types.Array:
 		stmt.Elem.VarType = v.ElemType
+	case *types.Slice:
+		stmt.Elem.VarType = v.ElemType
+	case *types.String:
+		stmt.Elem.VarType = new(types.Char)
 	default:
-		t.error("%s: expected range or array, but got %s", stmt.Iter.Value.Pos(), stmt.Iter.VarType)
+		t.error(diag.TypeMismatch, stmt.Iter.Value, "expected range, array, slice or string, but got %s", stmt.Iter.VarType)
+		stmt.Elem.VarType = new(types.Invalid)
 	}
 	stmt.Index.VarType = new(types.Int)
 
 	t.typecheckBlockStmt(stmt.Body)
 }
 
+func (t *typechecker) typecheckMatchStmt(stmt *ast.MatchStmt) {
+	t.typecheckExpr(stmt.Value)
+
+	// the patterns are checked against the underlying type
+	typ := types.Underlying(stmt.Value.Type())
+	switch typ.(type) {
+	case *types.Int, *types.String, *types.Enum:
+		// ok
+	case nil:
+		t.error(diag.VoidValue, stmt.Value, "unexpected void value")
+		typ = new(types.Invalid)
+	default:
+		t.error(diag.TypeMismatch, stmt.Value, "expected int, string or enum, but got %s", stmt.Value.Type())
+		typ = new(types.Invalid)
+	}
+
+	matched := make(map[string]bool)
+	var wildcard *ast.MatchArm
+	for _, arm := range stmt.Arms {
+		if wildcard != nil {
+			t.error(diag.DuplicatePattern, arm, "unreachable arm after _")
+		}
+		if arm.Patterns == nil && wildcard == nil {
+			wildcard = arm
+		}
+		for _, pat := range arm.Patterns {
+			t.typecheckPattern(pat, typ, matched)
+		}
+		t.typecheckBlockStmt(arm.Body)
+	}
+
+	enum, ok := typ.(*types.Enum)
+	if !ok || wildcard != nil {
+		return
+	}
+	var missing []string
+	for _, v := range enum.Variants {
+		if !matched[v.Name] {
+			missing = append(missing, v.Name)
+		}
+	}
+	if len(missing) > 0 {
+		t.error(diag.NonExhaustive, stmt.Value, "missing %s in match", strings.Join(missing, ", "))
+	}
+}
+
 func (t *typechecker) typecheckReturnStmt(stmt *ast.ReturnStmt) {
 	var returnType types.Type
 	switch v := stmt.Ref.(type) {
@@ -115,20 +264,26 @@ func (t *typechecker) typecheckReturnStmt(stmt *ast.ReturnStmt) {
 		returnType = v.ReturnType
 	case *ast.FuncLit:
 		returnType = v.ReturnType
+	default:
+		// illegal use of return
+		if stmt.Value != nil {
+			t.typecheckExpr(stmt.Value)
+		}
+		return
 	}
 
 	if stmt.Value == nil {
 		if returnType != nil {
-			t.error("%s: expected %s return, but got nothing", stmt.Value.Pos(), returnType)
+			t.error(diag.TypeMismatch, stmt, "expected %s return, but got nothing", returnType)
 		}
 	} else {
 		t.typecheckExpr(stmt.Value)
+		stmt.Value = t.coerce(stmt.Value, returnType)
 
 		if returnType == nil {
-			t.error("%s: expected no return, but got %s", stmt.Value.Pos(), stmt.Value.Type())
-		}
-		if !types.Same(stmt.Value.Type(), returnType) {
-			t.error("%s: expected %s return, but got %s", stmt.Value.Pos(), returnType, stmt.Value.Type())
+			t.error(diag.TypeMismatch, stmt.Value, "expected no return, but got %s", stmt.Value.Type())
+		} else if !types.Same(stmt.Value.Type(), returnType) {
+			t.error(diag.TypeMismatch, stmt.Value, "expected %s return, but got %s", returnType, stmt.Value.Type())
 		}
 	}
 }
@@ -137,17 +292,50 @@ func (t *typechecker) typecheckAssignStmt(stmt *ast.AssignStmt) {
 	t.typecheckExpr(stmt.Target)
 	t.typecheckExpr(stmt.Value)
 
+	// strings are immutable
+	targets := []ast.Expr{stmt.Target}
+	if v, ok := stmt.Target.(*ast.TupleLit); ok {
+		targets = v.Elems
+	}
+	for _, target := range targets {
+		if v, ok := target.(*ast.IndexExpr); ok {
+			if _, ok := types.Underlying(v.Left.Type()).(*types.String); ok {
+				t.error(diag.NotVariable, v, "cannot assign to substring")
+			}
+		}
+	}
+
 	switch stmt.Op {
 	case token.ASSIGN:
+		stmt.Value = t.coerce(stmt.Value, stmt.Target.Type())
 		if !types.Same(stmt.Target.Type(), stmt.Value.Type()) {
-			t.error("%s: expected %s value, but got %s", stmt.Value.Pos(), stmt.Target.Type(), stmt.Value.Type())
+			t.error(diag.TypeMismatch, stmt.Value, "expected %s value, but got %s", stmt.Target.Type(), stmt.Value.Type())
+		}
+	case token.SHLASSIGN, token.SHRASSIGN:
+		typ := intType(stmt.Target.Type())
+		if !types.Same(types.Underlying(stmt.Target.Type()), typ) {
+			t.error(diag.TypeMismatch, stmt.Target, "expected %s target, but got %s", typ, stmt.Target.Type())
+		}
+		if _, ok := types.Underlying(stmt.Value.Type()).(*types.Int); !ok {
+			t.error(diag.TypeMismatch, stmt.Value, "expected integer shift count, but got %s", stmt.Value.Type())
 		}
-	default: // +=, -=, *=, /=, %=
-		if _, ok := stmt.Target.Type().(*types.Int); !ok {
-			t.error("%s: expected int target, but got %s", stmt.Target.Pos(), stmt.Target.Type())
+	default: // +=, -=, *=, /=, %=, &=, |=, ^=
+		typ := numType(stmt.Target.Type())
+		switch stmt.Op {
+		case token.ADDASSIGN:
+			if _, ok := types.Underlying(stmt.Target.Type()).(*types.String); ok {
+				typ = new(types.String)
+			}
+		case token.MODASSIGN, token.ANDASSIGN, token.ORASSIGN, token.XORASSIGN:
+			typ = intType(stmt.Target.Type())
 		}
-		if _, ok := stmt.Value.Type().(*types.Int); !ok {
-			t.error("%s: expected int value, but got %s", stmt.Value.Pos(), stmt.Value.Type())
+		if !types.Same(types.Underlying(stmt.Target.Type()), typ) {
+			t.error(diag.TypeMismatch, stmt.Target, "expected %s target, but got %s", typ, stmt.Target.Type())
+			if !types.Same(types.Underlying(stmt.Value.Type()), typ) {
+				t.error(diag.TypeMismatch, stmt.Value, "expected %s value, but got %s", typ, stmt.Value.Type())
+			}
+		} else if !types.Same(stmt.Value.Type(), stmt.Target.Type()) {
+			t.error(diag.TypeMismatch, stmt.Value, "expected %s value, but got %s", stmt.Target.Type(), stmt.Value.Type())
 		}
 	}
 }
@@ -167,16 +355,26 @@ func (t *typechecker) typecheckExpr(expr ast.Expr) {
 		t.typecheckInfixExpr(v)
 	case *ast.IndexExpr:
 		t.typecheckIndexExpr(v)
+	case *ast.FieldExpr:
+		t.typecheckFieldExpr(v)
 	case *ast.CallExpr:
 		t.typecheckCallExpr(v)
 	case *ast.LibCallExpr:
 		t.typecheckLibCallExpr(v)
 	case *ast.Ident:
 		t.typecheckIdent(v)
+	case *ast.StructLit:
+		t.typecheckStructLit(v)
 	case *ast.IntLit:
 		v.SetType(new(types.Int))
+	case *ast.FloatLit:
+		v.SetType(new(types.Float))
+	case *ast.CharLit:
+		v.SetType(new(types.Char))
 	case *ast.BoolLit:
 		v.SetType(new(types.Bool))
+	case *ast.NoneLit:
+		v.SetType(new(types.Option)) // the element type is given by the context
 	case *ast.StringLit:
 		v.SetType(new(types.String))
 	case *ast.RangeLit:
@@ -185,8 +383,14 @@ func (t *typechecker) typecheckExpr(expr ast.Expr) {
 		t.typecheckArrayLit(v)
 	case *ast.ArrayShortLit:
 		t.typecheckArrayShortLit(v)
+	case *ast.SliceLit:
+		t.typecheckSliceLit(v)
+	case *ast.TupleLit:
+		t.typecheckTupleLit(v)
 	case *ast.FuncLit:
 		t.typecheckFuncLit(v)
+	case *ast.BadExpr:
+		v.SetType(new(types.Invalid))
 	}
 }
 
@@ -195,15 +399,28 @@ func (t *typechecker) typecheckPrefixExpr(expr *ast.PrefixExpr) {
 
 	switch expr.Op {
 	case token.BANG:
-		if _, ok := expr.Right.Type().(*types.Bool); !ok {
-			t.error("%s: expected bool operand, but got %s", expr.Right.Pos(), expr.Right.Type())
+		if _, ok := types.Underlying(expr.Right.Type()).(*types.Bool); !ok {
+			t.error(diag.TypeMismatch, expr.Right, "expected bool operand, but got %s", expr.Right.Type())
+			expr.SetType(new(types.Bool))
+			return
 		}
-		expr.SetType(new(types.Bool))
+		expr.SetType(expr.Right.Type())
+	case token.TILDE:
+		typ := intType(expr.Right.Type())
+		if !types.Same(types.Underlying(expr.Right.Type()), typ) {
+			t.error(diag.TypeMismatch, expr.Right, "expected int operand, but got %s", expr.Right.Type())
+			expr.SetType(new(types.Int))
+			return
+		}
+		expr.SetType(expr.Right.Type())
 	case token.MINUS:
-		if _, ok := expr.Right.Type().(*types.Int); !ok {
-			t.error("%s: expected int operand, but got %s", expr.Right.Pos(), expr.Right.Type())
+		typ := numType(expr.Right.Type())
+		if !types.Same(types.Underlying(expr.Right.Type()), typ) {
+			t.error(diag.TypeMismatch, expr.Right, "expected int operand, but got %s", expr.Right.Type())
+			expr.SetType(new(types.Int))
+			return
 		}
-		expr.SetType(new(types.Int))
+		expr.SetType(expr.Right.Type())
 	}
 }
 
@@ -211,104 +428,422 @@ func (t *typechecker) typecheckInfixExpr(expr *ast.InfixExpr) {
 	t.typecheckExpr(expr.Left)
 	t.typecheckExpr(expr.Right)
 
-	if expr.Left.Type() == nil {
-		t.error("%s: unexpected void value", expr.Left.Pos())
-	}
-	if expr.Right.Type() == nil {
-		t.error("%s: unexpected void value", expr.Right.Pos())
+	if expr.Left.Type() == nil || expr.Right.Type() == nil {
+		if expr.Left.Type() == nil {
+			t.error(diag.VoidValue, expr.Left, "unexpected void value")
+		}
+		if expr.Right.Type() == nil {
+			t.error(diag.VoidValue, expr.Right, "unexpected void value")
+		}
+		expr.SetType(new(types.Invalid))
+		return
 	}
 
 	switch expr.Op {
-	case token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.PERCENT:
-		if _, ok := expr.Left.Type().(*types.Int); !ok {
-			t.error("%s: expected int operand, but got %s", expr.Left.Pos(), expr.Left.Type())
+	case token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.PERCENT, token.AMP, token.PIPE, token.CARET:
+		typ := numType(expr.Left.Type())
+		switch expr.Op {
+		case token.PLUS:
+			// concatenation
+			if _, ok := types.Underlying(expr.Left.Type()).(*types.String); ok {
+				typ = new(types.String)
+			}
+		case token.PERCENT, token.AMP, token.PIPE, token.CARET:
+			typ = intType(expr.Left.Type())
+		}
+		if t.typecheckOperands(expr, typ) {
+			expr.SetType(expr.Left.Type())
+		} else {
+			expr.SetType(typ)
+		}
+	case token.SHL, token.SHR:
+		// the shift count may be of any integer type
+		typ := intType(expr.Left.Type())
+		ok := types.Same(types.Underlying(expr.Left.Type()), typ)
+		if !ok {
+			t.error(diag.TypeMismatch, expr.Left, "expected %s operand, but got %s", typ, expr.Left.Type())
 		}
-		if _, ok := expr.Right.Type().(*types.Int); !ok {
-			t.error("%s: expected int operand, but got %s", expr.Right.Pos(), expr.Right.Type())
+		if _, isInt := types.Underlying(expr.Right.Type()).(*types.Int); !isInt {
+			t.error(diag.TypeMismatch, expr.Right, "expected integer shift count, but got %s", expr.Right.Type())
+		}
+		if ok {
+			expr.SetType(expr.Left.Type())
+		} else {
+			expr.SetType(typ)
 		}
-		expr.SetType(new(types.Int))
 	case token.EQ, token.NE:
+		// comparison with none checks if the option is empty
+		none := false
+		if _, ok := expr.Right.(*ast.NoneLit); ok {
+			expr.Right = t.coerce(expr.Right, expr.Left.Type())
+			_, both := expr.Left.(*ast.NoneLit)
+			none = !both
+		} else if _, ok := expr.Left.(*ast.NoneLit); ok {
+			expr.Left = t.coerce(expr.Left, expr.Right.Type())
+			none = true
+		}
 		if !types.Same(expr.Left.Type(), expr.Right.Type()) {
-			t.error("%s: expected %s operand, but got %s", expr.Right.Pos(), expr.Left.Type(), expr.Right.Type())
+			t.error(diag.TypeMismatch, expr.Right, "expected %s operand, but got %s", expr.Left.Type(), expr.Right.Type())
+		} else if !none && !comparable(expr.Left.Type()) {
+			t.error(diag.NotComparable, expr, "%s values cannot be compared", expr.Left.Type())
 		}
 		expr.SetType(new(types.Bool))
 	case token.LT, token.LE, token.GT, token.GE:
-		if _, ok := expr.Left.Type().(*types.Int); !ok {
-			t.error("%s: expected int operand, but got %s", expr.Left.Pos(), expr.Left.Type())
-		}
-		if _, ok := expr.Right.Type().(*types.Int); !ok {
-			t.error("%s: expected int operand, but got %s", expr.Right.Pos(), expr.Right.Type())
+		typ := numType(expr.Left.Type())
+		switch v := types.Underlying(expr.Left.Type()).(type) {
+		case *types.Char, *types.String:
+			typ = v
 		}
+		t.typecheckOperands(expr, typ)
 		expr.SetType(new(types.Bool))
 	case token.AND, token.OR:
-		if _, ok := expr.Left.Type().(*types.Bool); !ok {
-			t.error("%s: expected bool operand, but got %s", expr.Left.Pos(), expr.Left.Type())
-		}
-		if _, ok := expr.Right.Type().(*types.Bool); !ok {
-			t.error("%s: expected bool operand, but got %s", expr.Right.Pos(), expr.Right.Type())
-		}
+		t.typecheckOperands(expr, new(types.Bool))
 		expr.SetType(new(types.Bool))
 	case token.IN:
-		switch v := expr.Right.Type().(type) {
+		switch v := types.Underlying(expr.Right.Type()).(type) {
 		case *types.Range:
-			if _, ok := expr.Left.Type().(*types.Int); !ok {
-				t.error("%s: expected int operand, but got %s", expr.Left.Pos(), expr.Left.Type())
+			if _, ok := types.Underlying(expr.Left.Type()).(*types.Int); !ok {
+				t.error(diag.TypeMismatch, expr.Left, "expected int operand, but got %s", expr.Left.Type())
 			}
 		case *types.Array:
-			if !types.Same(expr.Left.Type(), v.ElemType) {
-				t.error("%s: expected %s operand, but got %s", expr.Left.Pos(), v.ElemType, expr.Left.Type())
+			t.typecheckElemOperand(expr, v.ElemType)
+		case *types.Slice:
+			t.typecheckElemOperand(expr, v.ElemType)
+		case *types.String:
+			// substring search
+			if !types.Same(expr.Left.Type(), expr.Right.Type()) {
+				t.error(diag.TypeMismatch, expr.Left, "expected %s operand, but got %s", expr.Right.Type(), expr.Left.Type())
 			}
 		default:
-			t.error("%s: expected range or array, but got %s", expr.Right.Pos(), expr.Right.Type())
+			t.error(diag.TypeMismatch, expr.Right, "expected range, array, slice or string, but got %s", expr.Right.Type())
 		}
 		expr.SetType(new(types.Bool))
 	}
 }
 
+// typecheckElemOperand checks if the left operand of in can be compared with the elements of type elemType.
+func (t *typechecker) typecheckElemOperand(expr *ast.InfixExpr, elemType types.Type) {
+	if !types.Same(expr.Left.Type(), elemType) {
+		t.error(diag.TypeMismatch, expr.Left, "expected %s operand, but got %s", elemType, expr.Left.Type())
+	} else if !comparable(elemType) {
+		t.error(diag.NotComparable, expr, "%s values cannot be compared", elemType)
+	}
+}
+
+// typecheckOperands checks if the operands have the same type whose underlying type is typ.
+func (t *typechecker) typecheckOperands(expr *ast.InfixExpr, typ types.Type) bool {
+	if !types.Same(types.Underlying(expr.Left.Type()), typ) {
+		t.error(diag.TypeMismatch, expr.Left, "expected %s operand, but got %s", typ, expr.Left.Type())
+		if !types.Same(types.Underlying(expr.Right.Type()), typ) {
+			t.error(diag.TypeMismatch, expr.Right, "expected %s operand, but got %s", typ, expr.Right.Type())
+		}
+		return false
+	}
+	if !types.Same(expr.Right.Type(), expr.Left.Type()) {
+		t.error(diag.TypeMismatch, expr.Right, "expected %s operand, but got %s", expr.Left.Type(), expr.Right.Type())
+		return false
+	}
+	return true
+}
+
 func (t *typechecker) typecheckIndexExpr(expr *ast.IndexExpr) {
 	t.typecheckExpr(expr.Left)
 
-	arr, ok := expr.Left.Type().(*types.Array)
-	if !ok {
-		t.error("%s: expected array, but got %s", expr.Left.Pos(), expr.Left.Type())
+	// substring by the range of bytes
+	if _, ok := types.Underlying(expr.Left.Type()).(*types.String); ok {
+		t.typecheckExpr(expr.Index)
+		if _, ok := types.Underlying(expr.Index.Type()).(*types.Range); !ok {
+			t.error(diag.TypeMismatch, expr.Index, "expected range index, but got %s", expr.Index.Type())
+		}
+		expr.SetType(expr.Left.Type())
+		return
+	}
+
+	var elemType types.Type
+	switch v := types.Underlying(expr.Left.Type()).(type) {
+	case *types.Array:
+		elemType = v.ElemType
+	case *types.Slice:
+		elemType = v.ElemType
+	default:
+		t.error(diag.TypeMismatch, expr.Left, "expected array, slice or string, but got %s", expr.Left.Type())
+		elemType = new(types.Invalid)
 	}
 
 	t.typecheckExpr(expr.Index)
 
-	if _, ok := expr.Index.Type().(*types.Int); !ok {
-		t.error("%s: expected int index, but got %s", expr.Index.Pos(), expr.Index.Type())
+	if _, ok := types.Underlying(expr.Index.Type()).(*types.Int); !ok {
+		t.error(diag.TypeMismatch, expr.Index, "expected int index, but got %s", expr.Index.Type())
 	}
 
-	expr.SetType(arr.ElemType)
+	expr.SetType(elemType)
 }
 
-func (t *typechecker) typecheckCallExpr(expr *ast.CallExpr) {
+func (t *typechecker) typecheckFieldExpr(expr *ast.FieldExpr) {
+	if enum, _ := ast.EnumVariant(expr); enum != nil {
+		t.typecheckVariant(expr, enum)
+
+		if _, ok := expr.Type().(*types.Func); ok {
+			t.error(diag.ArgCount, expr, "missing payload of %s.%s", enum, expr.Name)
+			expr.SetType(new(types.Invalid))
+		}
+		return
+	}
+
 	t.typecheckExpr(expr.Left)
 
-	fn, ok := expr.Left.Type().(*types.Func)
+	s, ok := types.Underlying(expr.Left.Type()).(*types.Struct)
+	if !ok {
+		t.error(diag.TypeMismatch, expr.Left, "expected struct, but got %s", expr.Left.Type())
+		expr.SetType(new(types.Invalid))
+		return
+	}
+
+	field := s.Field(expr.Name)
+	if field == nil {
+		t.error(diag.UnknownField, expr, "%s has no field %s", s, expr.Name)
+		expr.SetType(new(types.Invalid))
+		return
+	}
+	expr.SetType(field.Type)
+}
+
+func (t *typechecker) typecheckCallExpr(expr *ast.CallExpr) {
+	if v, ok := expr.Left.(*ast.Ident); ok {
+		switch decl := v.Ref.(type) {
+		case *ast.FuncDecl:
+			if len(decl.TypeParams) > 0 {
+				t.typecheckGenericCall(expr, decl)
+				return
+			}
+		case *ast.TypeDecl:
+			t.typecheckConversion(expr, decl)
+			return
+		}
+	}
+
+	if enum, _ := ast.EnumVariant(expr.Left); enum != nil {
+		t.typecheckVariant(expr.Left.(*ast.FieldExpr), enum)
+	} else {
+		t.typecheckExpr(expr.Left)
+	}
+
+	fn, ok := types.Underlying(expr.Left.Type()).(*types.Func)
 	if !ok {
-		t.error("%s: expected function, but got %s", expr.Left.Pos(), expr.Left.Type())
+		t.error(diag.TypeMismatch, expr.Left, "expected function, but got %s", expr.Left.Type())
+
+		for _, param := range expr.Params {
+			t.typecheckExpr(param)
+		}
+		expr.SetType(new(types.Invalid))
+		return
 	}
 
 	if len(expr.Params) != len(fn.ParamTypes) {
-		t.error("%s: wrong number of parameters (expected %d, got %d)", expr.Pos(), len(fn.ParamTypes), len(expr.Params))
+		t.error(diag.ArgCount, expr, "wrong number of parameters (expected %d, got %d)", len(fn.ParamTypes), len(expr.Params))
 	}
 	for i, param := range expr.Params {
 		t.typecheckExpr(param)
 
+		if i < len(fn.ParamTypes) {
+			param = t.coerce(param, fn.ParamTypes[i])
+			expr.Params[i] = param
+			if !types.Same(param.Type(), fn.ParamTypes[i]) {
+				t.error(diag.TypeMismatch, param, "expected %s parameter, but got %s", fn.ParamTypes[i], param.Type())
+			}
+		}
+	}
+
+	expr.SetType(fn.ReturnType)
+}
+
+// typecheckGenericCall infers the type arguments from the parameters,
+// and makes the call refer to the instance of the generic function.
+func (t *typechecker) typecheckGenericCall(expr *ast.CallExpr, decl *ast.FuncDecl) {
+	for _, param := range expr.Params {
+		t.typecheckExpr(param)
+	}
+
+	if len(expr.Params) != len(decl.Params) {
+		t.error(diag.ArgCount, expr, "wrong number of parameters (expected %d, got %d)", len(decl.Params), len(expr.Params))
+		expr.Left.SetType(new(types.Invalid))
+		expr.SetType(new(types.Invalid))
+		return
+	}
+
+	args := make(map[*types.TypeParam]types.Type)
+	lens := make(map[*types.TypeParam]int)
+	for i, param := range expr.Params {
+		infer(decl.Params[i].VarType, param.Type(), args, lens)
+	}
+	for _, param := range decl.TypeParams {
+		_, ok1 := args[param.Type]
+		_, ok2 := lens[param.Type]
+		if !ok1 && !ok2 {
+			t.error(diag.CannotInfer, expr, "cannot infer %s of %s", param.Name, decl.Name)
+			expr.Left.SetType(new(types.Invalid))
+			expr.SetType(new(types.Invalid))
+			return
+		}
+	}
+
+	inst := t.instantiate(decl, args, lens, expr)
+
+	fn := new(types.Func)
+	for _, param := range inst.Params {
+		fn.ParamTypes = append(fn.ParamTypes, param.VarType)
+	}
+	fn.ReturnType = inst.ReturnType
+	expr.Left.SetType(fn)
+
+	for i, param := range expr.Params {
+		param = t.coerce(param, fn.ParamTypes[i])
+		expr.Params[i] = param
 		if !types.Same(param.Type(), fn.ParamTypes[i]) {
-			t.error("%s: expected %s parameter, but got %s", param.Pos(), fn.ParamTypes[i], param.Type())
+			t.error(diag.TypeMismatch, param, "expected %s parameter, but got %s", fn.ParamTypes[i], param.Type())
 		}
 	}
 
+	expr.Ref = inst
 	expr.SetType(fn.ReturnType)
 }
 
+// typecheckConversion checks the conversion to the type,
+// which is allowed between the types with the same underlying type.
+func (t *typechecker) typecheckConversion(expr *ast.CallExpr, decl *ast.TypeDecl) {
+	for _, param := range expr.Params {
+		t.typecheckExpr(param)
+	}
+	expr.SetType(decl.Type)
+
+	if len(expr.Params) != 1 {
+		t.error(diag.ArgCount, expr, "wrong number of parameters (expected 1, got %d)", len(expr.Params))
+		return
+	}
+	param := expr.Params[0]
+	if param.Type() == nil {
+		t.error(diag.VoidValue, param, "unexpected void value")
+	} else if !convertible(param.Type(), decl.Type) {
+		t.error(diag.TypeMismatch, param, "cannot convert %s to %s", param.Type(), decl.Type)
+	} else if _, ok := types.Underlying(decl.Type).(*types.Char); ok {
+		// the other values are replaced with U+FFFD at runtime
+		if n, ok := ast.IntValue(param); ok && (n < 0 || n > utf8.MaxRune || !utf8.ValidRune(rune(n))) {
+			t.error(diag.OutOfRange, param, "%d is not a valid code point", n)
+		}
+	}
+}
+
+// convertible checks if the value of the type can be converted to the other type,
+// which is the case for the types with the same structure, the numeric types, chars and integers,
+// and arrays into slices of the same element type.
+func convertible(from types.Type, to types.Type) bool {
+	from, to = types.Underlying(from), types.Underlying(to)
+	if types.Same(from, to) {
+		return true
+	}
+	// arrays are converted into slices by copying the elements
+	if s, ok := to.(*types.Slice); ok {
+		a, ok := from.(*types.Array)
+		return ok && types.Same(a.ElemType, s.ElemType)
+	}
+	// chars are converted from and to integers by their code points
+	if _, ok := from.(*types.Char); ok {
+		_, ok := to.(*types.Int)
+		return ok
+	}
+	if _, ok := to.(*types.Char); ok {
+		_, ok := from.(*types.Int)
+		return ok
+	}
+	return types.Same(from, numType(from)) && types.Same(to, numType(to))
+}
+
+// typecheckVariant gives the variant the type of enum, or the type of function
+// which takes the payload and returns the enum.
+func (t *typechecker) typecheckVariant(expr *ast.FieldExpr, enum *types.Enum) {
+	expr.Left.SetType(enum)
+
+	i := enum.Variant(expr.Name)
+	if i < 0 {
+		t.error(diag.UnknownVariant, expr, "%s has no variant %s", enum, expr.Name)
+		expr.SetType(new(types.Invalid))
+		return
+	}
+
+	variant := enum.Variants[i]
+	if len(variant.Payload) == 0 {
+		expr.SetType(enum)
+	} else {
+		expr.SetType(&types.Func{ParamTypes: variant.Payload, ReturnType: enum})
+	}
+}
+
 func (t *typechecker) typecheckLibCallExpr(expr *ast.LibCallExpr) {
 	for _, param := range expr.Params {
 		t.typecheckExpr(param)
 	}
-	expr.SetType(nil) // both printf and puts return void
+	if expr.Name == "format" {
+		// desugared from the string interpolation
+		for _, param := range expr.Params {
+			if param.Type() == nil {
+				t.error(diag.VoidValue, param, "unexpected void value")
+			} else if !formattable(param.Type()) {
+				t.error(diag.TypeMismatch, param, "%s values cannot be interpolated", param.Type())
+			}
+		}
+		expr.SetType(new(types.String))
+		return
+	}
+	if expr.Name == "append" {
+		t.typecheckAppend(expr)
+		return
+	}
+	if expr.Name != "len" && expr.Name != "cap" {
+		expr.SetType(nil) // printf, puts and sleep return void
+		return
+	}
+
+	expr.SetType(new(types.Int))
+	if len(expr.Params) != 1 {
+		t.error(diag.ArgCount, expr, "wrong number of parameters (expected 1, got %d)", len(expr.Params))
+		return
+	}
+	param := expr.Params[0]
+	switch types.Underlying(param.Type()).(type) {
+	case *types.Slice:
+		// ok
+	case *types.String, *types.Array:
+		if expr.Name == "cap" {
+			t.error(diag.TypeMismatch, param, "expected slice parameter, but got %s", param.Type())
+		}
+	default:
+		want := "string, array or slice"
+		if expr.Name == "cap" {
+			want = "slice"
+		}
+		t.error(diag.TypeMismatch, param, "expected %s parameter, but got %s", want, param.Type())
+	}
+}
+
+// typecheckAppend checks the call of append, which adds the elements to the end of the slice in place.
+func (t *typechecker) typecheckAppend(expr *ast.LibCallExpr) {
+	expr.SetType(nil)
+	if len(expr.Params) == 0 {
+		t.error(diag.ArgCount, expr, "wrong number of parameters (expected at least 1, got 0)")
+		return
+	}
+	s, ok := types.Underlying(expr.Params[0].Type()).(*types.Slice)
+	if !ok {
+		t.error(diag.TypeMismatch, expr.Params[0], "expected slice parameter, but got %s", expr.Params[0].Type())
+		return
+	}
+	for i, param := range expr.Params[1:] {
+		param = t.coerce(param, s.ElemType)
+		expr.Params[i+1] = param
+		if !types.Same(param.Type(), s.ElemType) {
+			t.error(diag.TypeMismatch, param, "expected %s element, but got %s", s.ElemType, param.Type())
+		}
+	}
 }
 
 func (t *typechecker) typecheckIdent(expr *ast.Ident) {
@@ -316,38 +851,105 @@ func (t *typechecker) typecheckIdent(expr *ast.Ident) {
 	case *ast.VarDecl:
 		expr.SetType(v.VarType)
 	case *ast.FuncDecl:
+		if len(v.TypeParams) > 0 {
+			t.error(diag.CannotInfer, expr, "cannot use generic function %s without calling it", v.Name)
+			expr.SetType(new(types.Invalid))
+			return
+		}
 		fn := new(types.Func)
 		for _, param := range v.Params {
 			fn.ParamTypes = append(fn.ParamTypes, param.VarType)
 		}
 		fn.ReturnType = v.ReturnType
 		expr.SetType(fn)
+	default:
+		// not declared
+		expr.SetType(new(types.Invalid))
+	}
+}
+
+func (t *typechecker) typecheckStructLit(expr *ast.StructLit) {
+	decl, ok := expr.Ref.(*ast.StructDecl)
+	if !ok {
+		// not declared or not a struct
+		for _, field := range expr.Fields {
+			t.typecheckExpr(field.Value)
+		}
+		expr.SetType(new(types.Invalid))
+		return
+	}
+
+	given := make(map[string]bool)
+	for _, field := range expr.Fields {
+		t.typecheckExpr(field.Value)
+
+		f := decl.Type.Field(field.Name)
+		if f == nil {
+			t.error(diag.UnknownField, field, "%s has no field %s", decl.Type, field.Name)
+			continue
+		}
+		if given[field.Name] {
+			t.error(diag.DuplicateField, field, "field %s is given more than once", field.Name)
+			continue
+		}
+		given[field.Name] = true
+		field.VarType = f.Type
+		field.Value = t.coerce(field.Value, f.Type)
+
+		if field.Value.Type() == nil {
+			t.error(diag.TypeMismatch, field.Value, "expected %s value for %s, but got nothing", f.Type, f.Name)
+		} else if !types.Same(field.Value.Type(), f.Type) {
+			t.error(diag.TypeMismatch, field.Value, "expected %s value for %s, but got %s", f.Type, f.Name, field.Value.Type())
+		}
+	}
+	for _, f := range decl.Type.Fields {
+		if !given[f.Name] {
+			t.error(diag.MissingField, expr, "missing field %s in %s literal", f.Name, decl.Type)
+		}
 	}
+
+	expr.SetType(decl.Type)
 }
 
 func (t *typechecker) typecheckRangeLit(expr *ast.RangeLit) {
 	t.typecheckExpr(expr.Lower)
 	t.typecheckExpr(expr.Upper)
 
-	if _, ok := expr.Lower.Type().(*types.Int); !ok {
-		t.error("%s: expected int boundary, but got %s", expr.Lower.Pos(), expr.Lower.Type())
+	if _, ok := types.Underlying(expr.Lower.Type()).(*types.Int); !ok {
+		t.error(diag.TypeMismatch, expr.Lower, "expected int boundary, but got %s", expr.Lower.Type())
 	}
-	if _, ok := expr.Upper.Type().(*types.Int); !ok {
-		t.error("%s: expected int boundary, but got %s", expr.Upper.Pos(), expr.Upper.Type())
+	if _, ok := types.Underlying(expr.Upper.Type()).(*types.Int); !ok {
+		t.error(diag.TypeMismatch, expr.Upper, "expected int boundary, but got %s", expr.Upper.Type())
 	}
 
 	expr.SetType(new(types.Range))
 }
 
 func (t *typechecker) typecheckArrayLit(expr *ast.ArrayLit) {
-	t.typecheckExpr(expr.Elems[0])
-	elemType := expr.Elems[0].Type()
-
-	for _, elem := range expr.Elems[1:] {
+	// the element type is given by the first element other than none
+	var elemType types.Type
+	found, none := false, false
+	for _, elem := range expr.Elems {
 		t.typecheckExpr(elem)
 
-		if !types.Same(elem.Type(), elemType) {
-			t.error("%s: array elements have different types", expr.Pos())
+		if _, ok := elem.(*ast.NoneLit); ok {
+			none = true
+		} else if !found {
+			elemType = elem.Type()
+			found = true
+		}
+	}
+	if !found {
+		elemType = expr.Elems[0].Type()
+	} else if _, ok := types.Unalias(elemType).(*types.Option); none && !ok && elemType != nil {
+		elemType = &types.Option{ElemType: elemType}
+	}
+
+	for i, elem := range expr.Elems {
+		expr.Elems[i] = t.coerce(elem, elemType)
+
+		if !types.Same(expr.Elems[i].Type(), elemType) {
+			t.error(diag.MixedElems, expr, "array elements have different types")
 		}
 	}
 
@@ -357,14 +959,49 @@ func (t *typechecker) typecheckArrayLit(expr *ast.ArrayLit) {
 func (t *typechecker) typecheckArrayShortLit(expr *ast.ArrayShortLit) {
 	if expr.Value != nil {
 		t.typecheckExpr(expr.Value)
+		expr.Value = t.coerce(expr.Value, expr.ElemType)
 
 		if !types.Same(expr.Value.Type(), expr.ElemType) {
-			t.error("%s: expected %s element, but got %s", expr.Value.Pos(), expr.ElemType, expr.Value.Type())
+			// only arrays are converted into slices, since the lengths of slices are unknown until runtime
+			if s, ok := types.Underlying(expr.Value.Type()).(*types.Slice); ok && types.Same(s.ElemType, expr.ElemType) {
+				t.error(diag.TypeMismatch, expr.Value, "cannot convert %s to [%d]%s", expr.Value.Type(), expr.Len, expr.ElemType)
+			} else {
+				t.error(diag.TypeMismatch, expr.Value, "expected %s element, but got %s", expr.ElemType, expr.Value.Type())
+			}
 		}
 	}
 	expr.SetType(&types.Array{Len: expr.Len, ElemType: expr.ElemType})
 }
 
+func (t *typechecker) typecheckSliceLit(expr *ast.SliceLit) {
+	typ := &types.Slice{ElemType: expr.ElemType}
+	if expr.Value != nil {
+		t.typecheckExpr(expr.Value)
+
+		if expr.Value.Type() == nil {
+			t.error(diag.VoidValue, expr.Value, "unexpected void value")
+		} else if !convertible(expr.Value.Type(), typ) {
+			t.error(diag.TypeMismatch, expr.Value, "cannot convert %s to %s", expr.Value.Type(), typ)
+		}
+	}
+	expr.SetType(typ)
+}
+
+func (t *typechecker) typecheckTupleLit(expr *ast.TupleLit) {
+	tuple := new(types.Tuple)
+	for _, elem := range expr.Elems {
+		t.typecheckExpr(elem)
+
+		if elem.Type() == nil {
+			t.error(diag.VoidValue, elem, "unexpected void value")
+			tuple.ElemTypes = append(tuple.ElemTypes, new(types.Invalid))
+		} else {
+			tuple.ElemTypes = append(tuple.ElemTypes, elem.Type())
+		}
+	}
+	expr.SetType(tuple)
+}
+
 func (t *typechecker) typecheckFuncLit(expr *ast.FuncLit) {
 	t.typecheckBlockStmt(expr.Body)
 
@@ -376,6 +1013,95 @@ func (t *typechecker) typecheckFuncLit(expr *ast.FuncLit) {
 	expr.SetType(fn)
 }
 
+// ----------------------------------------------------------------
+// Pattern
+
+// typecheckPattern checks the pattern against the type of the matched value,
+// where matched holds the patterns which have already appeared.
+func (t *typechecker) typecheckPattern(pat ast.Expr, typ types.Type, matched map[string]bool) {
+	if v, ok := pat.(*ast.VariantPattern); ok {
+		t.typecheckVariantPattern(v, typ, matched)
+		return
+	}
+
+	t.typecheckExpr(pat)
+
+	if v, ok := typ.(*types.Int); ok {
+		if r, ok := pat.(*ast.RangeLit); ok {
+			t.typecheckIntPattern(r.Lower, v, false)
+			t.typecheckIntPattern(r.Upper, v, true)
+			return
+		}
+		if _, ok := pat.Type().(*types.Range); ok {
+			return
+		}
+		// integer literals match the values of any integer type
+		if _, ok := ast.IntValue(pat); ok {
+			t.typecheckIntPattern(pat, v, false)
+			pat.SetType(typ)
+		}
+	}
+	if !types.Same(pat.Type(), typ) {
+		t.error(diag.TypeMismatch, pat, "expected %s pattern, but got %s", typ, pat.Type())
+		return
+	}
+
+	var key string
+	if n, ok := ast.IntValue(pat); ok {
+		key = strconv.Itoa(n)
+	} else if v, ok := pat.(*ast.StringLit); ok {
+		key = strconv.Quote(v.Value)
+	}
+	if matched[key] {
+		t.error(diag.DuplicatePattern, pat, "%s is already matched", key)
+	}
+	matched[key] = true
+}
+
+// typecheckIntPattern checks that the integer literal is representable in the type of the matched value,
+// where the upper bound of range may be one past the maximum since it is exclusive.
+func (t *typechecker) typecheckIntPattern(pat ast.Expr, typ *types.Int, upper bool) {
+	n, ok := ast.IntValue(pat)
+	if !ok || representable(n, typ) || upper && representable(n-1, typ) {
+		return
+	}
+	t.error(diag.OutOfRange, pat, "%d is out of range for %s", n, typ)
+}
+
+func (t *typechecker) typecheckVariantPattern(pat *ast.VariantPattern, typ types.Type, matched map[string]bool) {
+	for _, binding := range pat.Bindings {
+		binding.VarType = new(types.Invalid)
+	}
+
+	enum, ok := typ.(*types.Enum)
+	if !ok {
+		t.error(diag.TypeMismatch, pat, "expected %s pattern, but got variant %s", typ, pat.Name)
+		pat.SetType(new(types.Invalid))
+		return
+	}
+	pat.SetType(enum)
+
+	i := enum.Variant(pat.Name)
+	if i < 0 {
+		t.error(diag.UnknownVariant, pat, "%s has no variant %s", enum, pat.Name)
+		return
+	}
+	if matched[pat.Name] {
+		t.error(diag.DuplicatePattern, pat, "%s is already matched", pat.Name)
+	}
+	matched[pat.Name] = true
+
+	payload := enum.Variants[i].Payload
+	if len(pat.Bindings) != len(payload) {
+		t.error(diag.ArgCount, pat, "wrong number of bindings (expected %d, got %d)", len(payload), len(pat.Bindings))
+	}
+	for i, binding := range pat.Bindings {
+		if i < len(payload) {
+			binding.VarType = payload[i]
+		}
+	}
+}
+
 // ----------------------------------------------------------------
 // Decl
 
@@ -392,8 +1118,9 @@ func (t *typechecker) typecheckVarDecl(decl *ast.VarDecl) {
 		if decl.VarType == nil {
 			decl.VarType = fn // type inference
 		} else {
-			if !types.Same(fn, decl.VarType) {
-				t.error("%s: expected %s value for %s, but got %s", decl.Value.Pos(), decl.VarType, decl.Name, fn)
+			decl.Value = t.coerce(v, decl.VarType)
+			if !types.Same(decl.Value.Type(), decl.VarType) {
+				t.error(diag.TypeMismatch, decl.Value, "expected %s value for %s, but got %s", decl.VarType, decl.Name, fn)
 			}
 		}
 		t.typecheckBlockStmt(v.Body)
@@ -402,20 +1129,307 @@ func (t *typechecker) typecheckVarDecl(decl *ast.VarDecl) {
 
 		if decl.VarType == nil {
 			if v.Type() == nil {
-				t.error("%s: %s has no initial value", decl.Pos(), decl.Name)
+				t.error(diag.MissingInitValue, decl, "%s has no initial value", decl.Name)
+				decl.VarType = new(types.Invalid)
+			} else if _, ok := v.(*ast.NoneLit); ok {
+				t.error(diag.CannotInfer, decl, "cannot infer type of %s from none", decl.Name)
+				decl.VarType = new(types.Invalid)
+			} else {
+				decl.VarType = v.Type() // type inference
 			}
-			decl.VarType = v.Type() // type inference
 		} else {
+			decl.Value = t.coerce(v, decl.VarType)
 			if v.Type() == nil {
-				t.error("%s: expected %s value for %s, but got nothing", decl.Value.Pos(), decl.VarType, decl.Name)
-			}
-			if !types.Same(v.Type(), decl.VarType) {
-				t.error("%s: expected %s value for %s, but got %s", decl.Value.Pos(), decl.VarType, decl.Name, v.Type())
+				t.error(diag.TypeMismatch, decl.Value, "expected %s value for %s, but got nothing", decl.VarType, decl.Name)
+			} else if !types.Same(decl.Value.Type(), decl.VarType) {
+				t.error(diag.TypeMismatch, decl.Value, "expected %s value for %s, but got %s", decl.VarType, decl.Name, v.Type())
 			}
 		}
 	}
 }
 
 func (t *typechecker) typecheckFuncDecl(decl *ast.FuncDecl) {
+	// generic functions are checked for each instance
+	if len(decl.TypeParams) > 0 {
+		return
+	}
 	t.typecheckBlockStmt(decl.Body)
 }
+
+// instantiate returns the instance of the generic function with the type arguments,
+// which is made and checked when it is requested first.
+func (t *typechecker) instantiate(decl *ast.FuncDecl, args map[*types.TypeParam]types.Type, lens map[*types.TypeParam]int, site ast.Node) *ast.FuncDecl {
+	if t.instances == nil {
+		t.instances = make(map[*ast.FuncDecl][]*instance)
+	}
+	for i, inst := range t.instances[decl] {
+		if sameArgs(decl, inst, args, lens) {
+			return decl.Instances[i]
+		}
+	}
+
+	subst := func(typ types.Type) types.Type {
+		return substitute(typ, args, lens)
+	}
+	clone := ast.Clone(decl, subst).(*ast.FuncDecl)
+	clone.TypeParams = nil
+
+	inst := &instance{decl: decl, args: args, lens: lens, site: site}
+	t.instances[decl] = append(t.instances[decl], inst)
+	decl.Instances = append(decl.Instances, clone)
+
+	if t.depth >= maxInstDepth {
+		t.error(diag.RecursiveType, site, "instantiation of %s is too deep", decl.Name)
+		return clone
+	}
+
+	outer := t.inst
+	t.inst = inst
+	t.depth++
+	t.typecheckBlockStmt(clone.Body)
+	t.depth--
+	t.inst = outer
+
+	return clone
+}
+
+func (t *typechecker) typecheckStructDecl(decl *ast.StructDecl) {
+	if embeds(decl.Type, decl.Type, make(map[types.Type]bool)) {
+		t.error(diag.RecursiveType, decl, "invalid recursive type %s", decl.Name)
+	}
+}
+
+func (t *typechecker) typecheckEnumDecl(decl *ast.EnumDecl) {
+	if embeds(decl.Type, decl.Type, make(map[types.Type]bool)) {
+		t.error(diag.RecursiveType, decl, "invalid recursive type %s", decl.Name)
+	}
+}
+
+// coerce returns the expression converted to the type if it is the option type
+// and the expression gives its content or none, where the content may be wrapped into the nested options.
+// Otherwise the expression is returned as is.
+func (t *typechecker) coerce(expr ast.Expr, typ types.Type) ast.Expr {
+	opt, ok := types.Unalias(typ).(*types.Option)
+	if !ok || expr.Type() == nil {
+		return expr
+	}
+	if _, ok := expr.(*ast.NoneLit); ok {
+		expr.SetType(typ)
+		return expr
+	}
+	// the value is wrapped as many times as the options are nested
+	expr = t.coerce(expr, opt.ElemType)
+	if !types.Same(expr.Type(), opt.ElemType) {
+		return expr
+	}
+	some := &ast.SomeExpr{Value: expr}
+	some.SetPos(expr.Pos())
+	some.SetEnd(expr.End())
+	some.SetType(typ)
+	return some
+}
+
+// maxInstDepth is the limit of nested instantiations,
+// which prevents the generic functions from instantiating themselves infinitely.
+const maxInstDepth = 10
+
+// infer binds the type parameters in the parameter type by matching it with the argument type.
+// The parameters bound already are kept, and the conflicts are reported after substitution.
+func infer(param types.Type, arg types.Type, args map[*types.TypeParam]types.Type, lens map[*types.TypeParam]int) {
+	arg = types.Unalias(arg)
+
+	switch v := types.Unalias(param).(type) {
+	case *types.TypeParam:
+		if opt, ok := arg.(*types.Option); ok && opt.ElemType == nil {
+			return // none gives no clue
+		}
+		if _, ok := args[v]; !ok && arg != nil {
+			args[v] = arg
+		}
+	case *types.Array:
+		a, ok := arg.(*types.Array)
+		if !ok {
+			return
+		}
+		if v.LenParam != nil {
+			if _, ok := lens[v.LenParam]; !ok {
+				lens[v.LenParam] = a.Len
+			}
+		}
+		infer(v.ElemType, a.ElemType, args, lens)
+	case *types.Slice:
+		if a, ok := arg.(*types.Slice); ok {
+			infer(v.ElemType, a.ElemType, args, lens)
+		}
+	case *types.Option:
+		if a, ok := arg.(*types.Option); ok {
+			infer(v.ElemType, a.ElemType, args, lens)
+			return
+		}
+		infer(v.ElemType, arg, args, lens) // the content given for option
+	case *types.Tuple:
+		a, ok := arg.(*types.Tuple)
+		if !ok || len(a.ElemTypes) != len(v.ElemTypes) {
+			return
+		}
+		for i := range v.ElemTypes {
+			infer(v.ElemTypes[i], a.ElemTypes[i], args, lens)
+		}
+	case *types.Func:
+		a, ok := arg.(*types.Func)
+		if !ok || len(a.ParamTypes) != len(v.ParamTypes) {
+			return
+		}
+		for i := range v.ParamTypes {
+			infer(v.ParamTypes[i], a.ParamTypes[i], args, lens)
+		}
+		infer(v.ReturnType, a.ReturnType, args, lens)
+	}
+}
+
+// substitute replaces the type parameters in the type with the type arguments.
+func substitute(typ types.Type, args map[*types.TypeParam]types.Type, lens map[*types.TypeParam]int) types.Type {
+	switch v := typ.(type) {
+	case *types.TypeParam:
+		if arg, ok := args[v]; ok {
+			return arg
+		}
+		return v
+	case *types.Array:
+		arr := &types.Array{Len: v.Len, LenParam: v.LenParam, ElemType: substitute(v.ElemType, args, lens)}
+		if n, ok := lens[v.LenParam]; ok {
+			arr.Len = n
+			arr.LenParam = nil
+		}
+		return arr
+	case *types.Slice:
+		return &types.Slice{ElemType: substitute(v.ElemType, args, lens)}
+	case *types.Option:
+		return &types.Option{ElemType: substitute(v.ElemType, args, lens)}
+	case *types.Tuple:
+		tuple := new(types.Tuple)
+		for _, elem := range v.ElemTypes {
+			tuple.ElemTypes = append(tuple.ElemTypes, substitute(elem, args, lens))
+		}
+		return tuple
+	case *types.Func:
+		fn := new(types.Func)
+		for _, param := range v.ParamTypes {
+			fn.ParamTypes = append(fn.ParamTypes, substitute(param, args, lens))
+		}
+		if v.ReturnType != nil {
+			fn.ReturnType = substitute(v.ReturnType, args, lens)
+		}
+		return fn
+	default:
+		return typ
+	}
+}
+
+// sameArgs checks if the instance has the same type arguments.
+func sameArgs(decl *ast.FuncDecl, inst *instance, args map[*types.TypeParam]types.Type, lens map[*types.TypeParam]int) bool {
+	for _, param := range decl.TypeParams {
+		if !types.Same(inst.args[param.Type], args[param.Type]) || inst.lens[param.Type] != lens[param.Type] {
+			return false
+		}
+	}
+	return true
+}
+
+// numType returns the type of the numeric operands, which is the underlying type of the given operand
+// if it is integer or float, and int otherwise.
+func numType(typ types.Type) types.Type {
+	switch v := types.Underlying(typ).(type) {
+	case *types.Int, *types.Float:
+		return v
+	default:
+		return new(types.Int)
+	}
+}
+
+// intType is like numType, but gives int for float.
+func intType(typ types.Type) types.Type {
+	if v, ok := types.Underlying(typ).(*types.Int); ok {
+		return v
+	}
+	return new(types.Int)
+}
+
+// representable checks if the integer fits in the type without wrapping.
+// The 64-bit types hold any literal, since the prefixed ones give the raw bits.
+func representable(n int, typ *types.Int) bool {
+	if typ.Size == 0 || typ.Size == 8 {
+		return true
+	}
+	bits := uint(typ.Size * 8)
+	if typ.Unsigned {
+		return n >= 0 && n < 1<<bits
+	}
+	return n >= -1<<(bits-1) && n < 1<<(bits-1)
+}
+
+// formattable checks if the values of the type can be interpolated into strings.
+func formattable(typ types.Type) bool {
+	switch v := types.Underlying(typ).(type) {
+	case *types.Int, *types.Float, *types.Char, *types.Bool, *types.String, *types.Range:
+		return true
+	case *types.Array:
+		return formattable(v.ElemType)
+	case *types.Slice:
+		return formattable(v.ElemType)
+	default:
+		return false
+	}
+}
+
+// comparable checks if the values of the type can be compared by == or !=.
+func comparable(typ types.Type) bool {
+	switch types.Underlying(typ).(type) {
+	case *types.Struct, *types.Tuple, *types.Enum, *types.Option, *types.Slice:
+		return false
+	default:
+		return true
+	}
+}
+
+// embeds checks if the values of the type contain the target struct or enum,
+// either directly or through other types.
+// Slices refer to their elements on the heap, so they do not embed them.
+func embeds(typ types.Type, target types.Type, seen map[types.Type]bool) bool {
+	var inner []types.Type
+	switch v := typ.(type) {
+	case *types.Struct:
+		if seen[v] {
+			return false
+		}
+		seen[v] = true
+		for _, f := range v.Fields {
+			inner = append(inner, f.Type)
+		}
+	case *types.Enum:
+		if seen[v] {
+			return false
+		}
+		seen[v] = true
+		for _, variant := range v.Variants {
+			inner = append(inner, variant.Payload...)
+		}
+	case *types.Tuple:
+		inner = v.ElemTypes
+	case *types.Array:
+		inner = append(inner, v.ElemType)
+	case *types.Option:
+		inner = append(inner, v.ElemType)
+	case *types.Alias:
+		inner = append(inner, v.Type)
+	case *types.Defined:
+		inner = append(inner, v.Type)
+	}
+
+	for _, typ := range inner {
+		if typ == target || embeds(typ, target, seen) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package token
+
+// File represents a source file.
+type File struct {
+	Name  string // empty for the standard input
+	Src   []byte
+	id    int   // order in the file set
+	lines []int // offsets of the beginning of lines
+}
+
+// NewFile returns a source file which does not belong to any file set.
+func NewFile(name string, src []byte) *File {
+	f := &File{Name: name, Src: src, lines: []int{0}}
+	for i, b := range src {
+		if b == '\n' {
+			f.lines = append(f.lines, i+1)
+		}
+	}
+	return f
+}
+
+// Line returns the content of the n-th line without the line terminator.
+// It returns an empty string if the line does not exist.
+func (f *File) Line(n int) string {
+	if n < 1 || n > len(f.lines) {
+		return ""
+	}
+	begin := f.lines[n-1]
+	end := len(f.Src)
+	if n < len(f.lines) {
+		end = f.lines[n] - 1
+	}
+	if end > begin && f.Src[end-1] == '\r' {
+		end--
+	}
+	return string(f.Src[begin:end])
+}
+
+// FileSet represents a set of source files compiled together.
+type FileSet struct {
+	files []*File
+}
+
+// NewFileSet returns an empty file set.
+func NewFileSet() *FileSet {
+	return &FileSet{}
+}
+
+// AddFile adds a source file to the set.
+func (s *FileSet) AddFile(name string, src []byte) *File {
+	f := NewFile(name, src)
+	f.id = len(s.files) + 1
+	s.files = append(s.files, f)
+	return f
+}
+
+// Files returns the source files in the order they were added.
+func (s *FileSet) Files() []*File {
+	return s.files
+}
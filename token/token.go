@@ -5,7 +5,8 @@ import "fmt"
 // Token represents a lexical token.
 type Token struct {
 	Type    Type
-	Pos     *Pos
+	Pos     *Pos // position of the first character
+	End     *Pos // position immediately after the last character
 	Literal string
 }
 
@@ -18,14 +19,34 @@ func (t Type) String() string {
 
 // Pos represents the position of token.
 type Pos struct {
-	Line int
-	Col  int
+	File   *File
+	Offset int // in bytes
+	Line   int
+	Col    int // in characters
 }
 
 func (p *Pos) String() string {
+	if p.File != nil && p.File.Name != "" {
+		return fmt.Sprintf("%s:%d,%d", p.File.Name, p.Line, p.Col)
+	}
 	return fmt.Sprintf("%d,%d", p.Line, p.Col)
 }
 
+// Before checks if the position comes before the other one.
+func (p *Pos) Before(q *Pos) bool {
+	var pid, qid int
+	if p.File != nil {
+		pid = p.File.id
+	}
+	if q.File != nil {
+		qid = q.File.id
+	}
+	if pid != qid {
+		return pid < qid
+	}
+	return p.Offset < q.Offset
+}
+
 // The list of token types.
 const (
 	EOF Type = iota
@@ -40,6 +61,7 @@ const (
 	COMMA
 	COLON
 	SEMICOLON
+	QUESTION
 	ASSIGN
 	BANG
 	PLUS
@@ -47,9 +69,17 @@ const (
 	ASTERISK
 	SLASH
 	PERCENT
-
+	AMP
+	PIPE
+	CARET
+	TILDE
+	SHL
+	SHR
+
+	DOT
 	BETWEEN
 	ARROW
+	FATARROW
 
 	EQ
 	NE
@@ -65,6 +95,11 @@ const (
 	MULASSIGN
 	DIVASSIGN
 	MODASSIGN
+	ANDASSIGN
+	ORASSIGN
+	XORASSIGN
+	SHLASSIGN
+	SHRASSIGN
 
 	VAR
 	FUNC
@@ -76,9 +111,15 @@ const (
 	CONTINUE
 	BREAK
 	RETURN
+	STRUCT
+	ENUM
+	MATCH
+	TYPE
 
 	VOID
 	INT
+	FLOAT
+	CHAR
 	BOOL
 	STRING
 	RANGE
@@ -87,7 +128,12 @@ const (
 	NUMBER
 	TRUE
 	FALSE
+	NONE
 	QUOTED
+	QUOTEDHEAD
+	QUOTEDMID
+	QUOTEDTAIL
+	QUOTEDCHAR
 )
 
 var strings = map[Type]string{
@@ -103,6 +149,7 @@ var strings = map[Type]string{
 	COMMA:     ",",
 	COLON:     ":",
 	SEMICOLON: ";",
+	QUESTION:  "?",
 	ASSIGN:    "=",
 	BANG:      "!",
 	PLUS:      "+",
@@ -110,9 +157,17 @@ var strings = map[Type]string{
 	ASTERISK:  "*",
 	SLASH:     "/",
 	PERCENT:   "%",
-
-	BETWEEN: "..",
-	ARROW:   "->",
+	AMP:       "&",
+	PIPE:      "|",
+	CARET:     "^",
+	TILDE:     "~",
+	SHL:       "<<",
+	SHR:       ">>",
+
+	DOT:      ".",
+	BETWEEN:  "..",
+	ARROW:    "->",
+	FATARROW: "=>",
 
 	EQ:  "==",
 	NE:  "!=",
@@ -128,6 +183,11 @@ var strings = map[Type]string{
 	MULASSIGN: "*=",
 	DIVASSIGN: "/=",
 	MODASSIGN: "%=",
+	ANDASSIGN: "&=",
+	ORASSIGN:  "|=",
+	XORASSIGN: "^=",
+	SHLASSIGN: "<<=",
+	SHRASSIGN: ">>=",
 
 	VAR:      "var",
 	FUNC:     "func",
@@ -139,16 +199,27 @@ var strings = map[Type]string{
 	CONTINUE: "continue",
 	BREAK:    "break",
 	RETURN:   "return",
+	STRUCT:   "struct",
+	ENUM:     "enum",
+	MATCH:    "match",
+	TYPE:     "type",
 
 	VOID:   "void",
 	INT:    "int",
+	FLOAT:  "float",
+	CHAR:   "char",
 	BOOL:   "bool",
 	STRING: "string",
 	RANGE:  "range",
 
-	IDENT:  "identifier",
-	NUMBER: "number",
-	TRUE:   "true",
-	FALSE:  "false",
-	QUOTED: "quoted characters",
+	IDENT:      "identifier",
+	NUMBER:     "number",
+	TRUE:       "true",
+	FALSE:      "false",
+	NONE:       "none",
+	QUOTED:     "quoted characters",
+	QUOTEDHEAD: "quoted characters",
+	QUOTEDMID:  "quoted characters",
+	QUOTEDTAIL: "quoted characters",
+	QUOTEDCHAR: "quoted character",
 }
@@ -3,6 +3,8 @@ package types
 import (
 	"fmt"
 	"strings"
+
+	"github.com/oshima/lang/token"
 )
 
 // ----------------------------------------------------------------
@@ -16,11 +18,35 @@ type Type interface {
 // ----------------------------------------------------------------
 // Types
 
-// Int represents the integer type.
-type Int struct{}
+// Int represents the integer types.
+// The zero value is int of signed 64 bits, and the sized ones such as i8 and u32 have their sizes.
+type Int struct {
+	Size     int // in bytes, or 0 for int
+	Unsigned bool
+}
 
 func (i *Int) String() string {
-	return "int"
+	if i.Size == 0 {
+		return "int"
+	}
+	if i.Unsigned {
+		return fmt.Sprintf("u%d", i.Size*8)
+	}
+	return fmt.Sprintf("i%d", i.Size*8)
+}
+
+// Float represents the floating-point type of 64 bits.
+type Float struct{}
+
+func (f *Float) String() string {
+	return "float"
+}
+
+// Char represents the character type, whose value is a Unicode code point.
+type Char struct{}
+
+func (c *Char) String() string {
+	return "char"
 }
 
 // Bool represents the boolean type.
@@ -45,15 +71,29 @@ func (r *Range) String() string {
 }
 
 // Array represents the array type.
+// The length is given by LenParam instead of Len in generic functions.
 type Array struct {
 	Len      int
+	LenParam *TypeParam
 	ElemType Type
 }
 
 func (a *Array) String() string {
+	if a.LenParam != nil {
+		return fmt.Sprintf("[%s]%s", a.LenParam, a.ElemType)
+	}
 	return fmt.Sprintf("[%d]%s", a.Len, a.ElemType)
 }
 
+// Slice represents the type of growable array, whose length is not a part of the type.
+type Slice struct {
+	ElemType Type
+}
+
+func (s *Slice) String() string {
+	return fmt.Sprintf("[]%s", s.ElemType)
+}
+
 // Func represents the function type.
 type Func struct {
 	ParamTypes []Type
@@ -70,3 +110,133 @@ func (f *Func) String() string {
 	}
 	return fmt.Sprintf("(%s) -> %s", strings.Join(params, ", "), f.ReturnType)
 }
+
+// Tuple represents the tuple type, such as the multiple return values of functions.
+type Tuple struct {
+	ElemTypes []Type
+}
+
+func (t *Tuple) String() string {
+	var elems []string
+	for _, typ := range t.ElemTypes {
+		elems = append(elems, typ.String())
+	}
+	return fmt.Sprintf("(%s)", strings.Join(elems, ", "))
+}
+
+// Option represents the option type, whose value may be none.
+type Option struct {
+	ElemType Type
+}
+
+func (o *Option) String() string {
+	if o.ElemType == nil {
+		return "none" // type of none before given by the context
+	}
+	return fmt.Sprintf("?%s", o.ElemType)
+}
+
+// Struct represents the struct type.
+// Struct types are identified by their declarations, not by their fields.
+type Struct struct {
+	Name   string
+	Fields []*Field
+}
+
+func (s *Struct) String() string {
+	return s.Name
+}
+
+// Field returns the field of the name, or nil if not found.
+func (s *Struct) Field(name string) *Field {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Enum represents the enum type, whose value is one of the variants with its payload.
+// Enum types are identified by their declarations, like struct types.
+type Enum struct {
+	Name     string
+	Variants []*Variant
+}
+
+func (e *Enum) String() string {
+	return e.Name
+}
+
+// Variant returns the index of the variant of the name, or -1 if not found.
+func (e *Enum) Variant(name string) int {
+	for i, v := range e.Variants {
+		if v.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Variant represents a variant of enum type.
+type Variant struct {
+	Name    string
+	Payload []Type
+}
+
+// Field represents a field of struct type.
+type Field struct {
+	Name string
+	Type Type
+}
+
+// Alias represents the alias of another type.
+// Alias types are the same as the aliased types, except that they are printed by their names.
+type Alias struct {
+	Name string
+	Type Type
+}
+
+func (a *Alias) String() string {
+	return a.Name
+}
+
+// Defined represents the type declared with a name, which is distinct from any other type
+// but has the same representation and operations as the underlying type.
+type Defined struct {
+	Name string
+	Type Type
+}
+
+func (d *Defined) String() string {
+	return d.Name
+}
+
+// Named represents the type referred by name, which is replaced with
+// the declared type during name resolution.
+type Named struct {
+	Name string
+	Pos  *token.Pos // position of the name, for diagnostics
+	End  *token.Pos
+}
+
+func (n *Named) String() string {
+	return n.Name
+}
+
+// TypeParam represents a type parameter of generic function,
+// which stands for either a type or an array length.
+type TypeParam struct {
+	Name string
+}
+
+func (t *TypeParam) String() string {
+	return t.Name
+}
+
+// Invalid represents the type of erroneous expressions.
+type Invalid struct{}
+
+func (i *Invalid) String() string {
+	return "invalid"
+}
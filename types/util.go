@@ -2,9 +2,17 @@ package types
 
 // Same checks if the two input types are same or not.
 func Same(typ1 Type, typ2 Type) bool {
+	typ1, typ2 = Unalias(typ1), Unalias(typ2)
+
 	switch v1 := typ1.(type) {
 	case *Int:
-		_, ok := typ2.(*Int)
+		v2, ok := typ2.(*Int)
+		return ok && v1.Size == v2.Size && v1.Unsigned == v2.Unsigned
+	case *Float:
+		_, ok := typ2.(*Float)
+		return ok
+	case *Char:
+		_, ok := typ2.(*Char)
 		return ok
 	case *Bool:
 		_, ok := typ2.(*Bool)
@@ -20,10 +28,13 @@ func Same(typ1 Type, typ2 Type) bool {
 		if !ok {
 			return false
 		}
-		if v1.Len != v2.Len {
+		if v1.Len != v2.Len || v1.LenParam != v2.LenParam {
 			return false
 		}
 		return Same(v1.ElemType, v2.ElemType)
+	case *Slice:
+		v2, ok := typ2.(*Slice)
+		return ok && Same(v1.ElemType, v2.ElemType)
 	case *Func:
 		v2, ok := typ2.(*Func)
 		if !ok {
@@ -38,8 +49,65 @@ func Same(typ1 Type, typ2 Type) bool {
 			}
 		}
 		return Same(v1.ReturnType, v2.ReturnType)
+	case *Tuple:
+		v2, ok := typ2.(*Tuple)
+		if !ok {
+			return false
+		}
+		if len(v1.ElemTypes) != len(v2.ElemTypes) {
+			return false
+		}
+		for i := range v1.ElemTypes {
+			if !Same(v1.ElemTypes[i], v2.ElemTypes[i]) {
+				return false
+			}
+		}
+		return true
+	case *Option:
+		v2, ok := typ2.(*Option)
+		return ok && Same(v1.ElemType, v2.ElemType)
+	case *Struct:
+		v2, ok := typ2.(*Struct)
+		return ok && v1 == v2
+	case *Enum:
+		v2, ok := typ2.(*Enum)
+		return ok && v1 == v2
+	case *Defined:
+		v2, ok := typ2.(*Defined)
+		return ok && v1 == v2
+	case *TypeParam:
+		v2, ok := typ2.(*TypeParam)
+		return ok && v1 == v2
+	case *Invalid:
+		return false
 	default:
 		// typ1 is nil
 		return typ2 == nil
 	}
 }
+
+// Unalias returns the type aliased by the type, or the type itself if it is not an alias.
+func Unalias(typ Type) Type {
+	for {
+		v, ok := typ.(*Alias)
+		if !ok {
+			return typ
+		}
+		typ = v.Type
+	}
+}
+
+// Underlying returns the type with the aliases and the defined types replaced by
+// the types they stand for. The operations on values depend on the underlying type.
+func Underlying(typ Type) Type {
+	for {
+		switch v := typ.(type) {
+		case *Alias:
+			typ = v.Type
+		case *Defined:
+			typ = v.Type
+		default:
+			return typ
+		}
+	}
+}